@@ -8,11 +8,9 @@ import (
 	"strings"
 	"syscall/js"
 
+	"github.com/walteh/retab/v2/pkg/autoformat"
 	"github.com/walteh/retab/v2/pkg/format"
-	"github.com/walteh/retab/v2/pkg/format/cmdfmt"
 	"github.com/walteh/retab/v2/pkg/format/editorconfig"
-	"github.com/walteh/retab/v2/pkg/format/hclfmt"
-	"github.com/walteh/retab/v2/pkg/format/protofmt"
 	"gitlab.com/tozd/go/errors"
 )
 
@@ -21,71 +19,72 @@ var (
 	lastError  error
 )
 
-func getFormatter(formatType string, filename string) (format.Provider, error) {
-	if formatType == "auto" {
-		formatters := []format.Provider{
-			hclfmt.NewFormatter(),
-			protofmt.NewFormatter(),
-			cmdfmt.NewDartFormatter("dart"),
-			cmdfmt.NewTerraformFormatter("terraform"),
-		}
-		fmtr, err := format.AutoDetectFormatter(filename, formatters)
-		if err != nil {
-			return nil, errors.Errorf("auto-detecting formatter: %w", err)
-		}
-		if fmtr == nil {
-			return nil, errors.Errorf("no formatters found for file %q", filename)
-		}
-		return fmtr, nil
+func Fmt(ctx context.Context, this js.Value, args []js.Value) (string, error) {
+	if len(args) != 4 {
+		return "", errors.New("expected 4 arguments: formatter, filename, content, editorconfig-content")
 	}
 
-	switch formatType {
-	case "hcl":
-		return hclfmt.NewFormatter(), nil
-	case "proto":
-		return protofmt.NewFormatter(), nil
-	case "dart":
-		return cmdfmt.NewDartFormatter("dart"), nil
-	case "tf":
-		return cmdfmt.NewTerraformFormatter("terraform"), nil
-	default:
-		return nil, errors.Errorf("invalid formatter type: %q", formatType)
+	result, err := formatContent(ctx, args[0].String(), args[1].String(), args[2].String(), args[3].String())
+	if err != nil {
+		return "", err
 	}
+
+	return string(result), nil
 }
 
-func Fmt(ctx context.Context, this js.Value, args []js.Value) (string, error) {
+// FmtEdits takes the same arguments as Fmt but returns the minimal edits that
+// format the content, so editors do not have to replace the whole buffer.
+func FmtEdits(ctx context.Context, this js.Value, args []js.Value) ([]any, error) {
 	if len(args) != 4 {
-		return "", errors.New("expected 4 arguments: formatter, filename, content, editorconfig-content")
+		return nil, errors.New("expected 4 arguments: formatter, filename, content, editorconfig-content")
 	}
 
-	formatter := args[0].String()
-	filename := args[1].String()
 	content := args[2].String()
-	editorconfigContent := args[3].String()
 
+	result, err := formatContent(ctx, args[0].String(), args[1].String(), content, args[3].String())
+	if err != nil {
+		return nil, err
+	}
+
+	// js.ValueOf only understands basic types, maps and slices
+	edits := []any{}
+	for _, edit := range format.ComputeEdits([]byte(content), result) {
+		edits = append(edits, map[string]any{
+			"startLine": edit.Start.Line,
+			"startCol":  edit.Start.Column,
+			"endLine":   edit.End.Line,
+			"endCol":    edit.End.Column,
+			"newText":   edit.NewText,
+		})
+	}
+
+	return edits, nil
+}
+
+func formatContent(ctx context.Context, formatter, filename, content, editorconfigContent string) ([]byte, error) {
 	// Setup editorconfig with either raw content or auto-resolution
 	cfgProvider, err := editorconfig.NewDynamicConfigurationProvider(ctx, editorconfigContent)
 	if err != nil {
-		return "", errors.Errorf("creating configuration provider: %w", err)
+		return nil, errors.Errorf("creating configuration provider: %w", err)
 	}
 
 	// Get the appropriate formatter
-	fmtr, err := getFormatter(formatter, filename)
+	fmtr, err := autoformat.FindFormatter(ctx, cfgProvider, formatter, filename, []byte(content))
 	if err != nil {
-		return "", errors.Errorf("getting formatter: %w", err)
+		return nil, errors.Errorf("getting formatter: %w", err)
 	}
 
 	// Format the content
 	r, err := format.Format(ctx, fmtr, cfgProvider, filename, strings.NewReader(content))
 	if err != nil {
-		return "", errors.Errorf("formatting content: %w", err)
+		return nil, errors.Errorf("formatting content: %w", err)
 	}
 
 	// Read the formatted content
 	result, err := io.ReadAll(r)
 	if err != nil {
-		return "", errors.Errorf("reading formatted content: %w", err)
+		return nil, errors.Errorf("reading formatted content: %w", err)
 	}
 
-	return string(result), nil
+	return result, nil
 }
@@ -18,7 +18,8 @@ func main() {
 
 	// Initialize the retab object
 	retab := map[string]interface{}{
-		"fmt": wrapResult(ctx, fmtcmd.Fmt),
+		"fmt":      wrapResult(ctx, fmtcmd.Fmt),
+		"fmtEdits": wrapResult(ctx, fmtcmd.FmtEdits),
 	}
 
 	// Set the retab object first
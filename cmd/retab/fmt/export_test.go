@@ -0,0 +1,3 @@
+package fmt
+
+var NewFmtCommandFs = newFmtCommand
@@ -4,123 +4,555 @@ package fmt
 // based on the language style guides provided by Hashicorp. This is done using the official hcl2 library.
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
+	"github.com/walteh/retab/v2/pkg/autoformat"
+	"github.com/walteh/retab/v2/pkg/filesystem"
 	"github.com/walteh/retab/v2/pkg/format"
-	"github.com/walteh/retab/v2/pkg/format/cmdfmt"
 	"github.com/walteh/retab/v2/pkg/format/editorconfig"
-	"github.com/walteh/retab/v2/pkg/format/hclfmt"
-	"github.com/walteh/retab/v2/pkg/format/protofmt"
 	"gitlab.com/tozd/go/errors"
 )
 
+// outputEditsJSON prints one json object per changed file with the minimal
+// edits that format it, instead of writing the file.
+const outputEditsJSON = "edits-json"
+
+// reportSARIF prints a SARIF log of the unformatted files and parse errors in
+// check mode, instead of their paths.
+const reportSARIF = "sarif"
+
+// UnformattedError is returned in check mode when at least one file is not
+// formatted, so callers can tell it apart from a formatter failure.
+type UnformattedError struct {
+	Files []string
+}
+
+func (me *UnformattedError) Error() string {
+	if len(me.Files) == 1 {
+		return "1 file is not formatted"
+	}
+	return strconv.Itoa(len(me.Files)) + " files are not formatted"
+}
+
+// ReportedError is returned when the error was already written to stderr as
+// diagnostics, so it should not be printed again.
+type ReportedError struct {
+	Err error
+}
+
+func (me *ReportedError) Error() string {
+	return me.Err.Error()
+}
+
+func (me *ReportedError) Unwrap() error {
+	return me.Err
+}
+
 type Handler struct {
-	filename            string
-	formatter           string // auto, hcl, proto, dart, tf
+	filenames           []string
+	formatter           string // auto or a name in format.DefaultRegistry
 	ToStdout            bool
 	FromStdin           bool
+	Check               bool
+	Diff                bool
+	Staged              bool
+	Output              string // empty to write files, or edits-json
+	Jobs                int    // files formatted at the same time, 0 for GOMAXPROCS
+	List                bool   // print the changed paths instead of a summary
+	Diagnostics         string // text, json or sarif
+	Report              string // empty to list unformatted files, or sarif
 	editorconfigContent string
+
+	fs     afero.Fs
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
 }
 
 func NewFmtCommand() *cobra.Command {
-	me := &Handler{}
+	return newFmtCommand(afero.NewOsFs())
+}
+
+// newFmtCommand returns the command formatting the files of fs, which tests
+// replace with an in-memory filesystem.
+func newFmtCommand(fs afero.Fs) *cobra.Command {
+	me := &Handler{fs: fs, stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
 
 	cmd := &cobra.Command{
-		Use:   "fmt",
+		Use:   "fmt [file|dir|glob]...",
 		Short: "format files with the hcl golang library, but with tabs",
 	}
 
-	cmd.Flags().StringVar(&me.formatter, "formatter", "auto", "the formatter to use")
+	cmd.Flags().StringVar(&me.formatter, "formatter", "auto", "the formatter to use (auto, "+strings.Join(format.DefaultRegistry.Names(), ", ")+")")
 	cmd.Flags().BoolVar(&me.ToStdout, "stdout", false, "write to stdout instead of file")
 	cmd.Flags().BoolVar(&me.FromStdin, "stdin", false, "read from stdin instead of file")
+	cmd.Flags().BoolVar(&me.Check, "check", false, "list files that are not formatted and fail instead of writing them")
+	cmd.Flags().BoolVar(&me.Diff, "diff", false, "print a unified diff of the changes instead of writing them")
+	cmd.Flags().BoolVar(&me.Staged, "staged", false, "format the staged files in the git index (args limit the paths)")
+	cmd.Flags().StringVar(&me.Output, "output", "", "print the changes instead of writing them (edits-json)")
+	cmd.Flags().StringVar(&me.Diagnostics, "diagnostics", format.DiagnosticsText, "how to write parse errors to stderr (text, json, sarif)")
+	cmd.Flags().StringVar(&me.Report, "report", "", "with --check, print a report of the unformatted files and parse errors instead of their paths (sarif)")
+	cmd.Flags().BoolVarP(&me.List, "list", "l", false, "print only the paths of the files that changed")
+	cmd.Flags().IntVarP(&me.Jobs, "jobs", "j", runtime.GOMAXPROCS(0), "the number of files to format at the same time")
 
 	cmd.Flags().StringVar(&me.editorconfigContent, "editorconfig-content", "", "editorconfig content (optional)")
-	cmd.Args = cobra.ExactArgs(1)
+	cmd.Args = func(cmd *cobra.Command, args []string) error {
+		if me.Staged {
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	}
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		me.filename = args[0]
+		me.filenames = args
+		me.stdin, me.stdout, me.stderr = cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr()
 		return me.Run(cmd.Context())
 	}
 
 	return cmd
 }
 
-func (me *Handler) getFormatter(ctx context.Context) (format.Provider, error) {
-	if me.formatter == "auto" {
-		formatters := []format.Provider{
-			hclfmt.NewFormatter(),
-			protofmt.NewFormatter(),
-			cmdfmt.NewDartFormatter("dart"),
-			cmdfmt.NewTerraformFormatter("terraform"),
-		}
-		fmtr, err := format.AutoDetectFormatter(me.filename, formatters)
+// getFormatter resolves the formatter for the file, sniffing the content when
+// it is given and the file name is inconclusive.
+func (me *Handler) getFormatter(ctx context.Context, cfgProvider format.ConfigurationProvider, filename string, content []byte) (format.Provider, error) {
+	return autoformat.FindFormatter(ctx, cfgProvider, me.formatter, filename, content)
+}
+
+// resolveFiles expands the arguments into the list of files to format. Files
+// found by walking a directory or glob are only kept if a formatter targets
+// them or the editorconfig declares an external one, also when the formatter
+// is forced with --formatter, while files named explicitly are always kept.
+func (me *Handler) resolveFiles(ctx context.Context, cfgProvider format.ConfigurationProvider) ([]string, error) {
+	seen := map[string]bool{}
+	files := []string{}
+	for _, arg := range me.filenames {
+		matches, err := filesystem.ExpandPaths(ctx, me.fs, []string{arg})
 		if err != nil {
-			return nil, errors.Errorf("auto-detecting formatter: %w", err)
+			return nil, errors.Errorf("expanding '%s': %w", arg, err)
 		}
-		if fmtr == nil {
-			return nil, errors.Errorf("no formatters found for file '%s'", me.filename)
+
+		for _, match := range matches {
+			if seen[match] {
+				continue
+			}
+
+			if match != arg {
+				ok, err := autoformat.Targeted(ctx, cfgProvider, me.formatter, match)
+				if err != nil {
+					return nil, errors.Errorf("resolving formatter for '%s': %w", match, err)
+				}
+				if !ok {
+					continue
+				}
+			}
+
+			seen[match] = true
+			files = append(files, match)
 		}
-		return fmtr, nil
 	}
 
-	switch me.formatter {
-	case "hcl":
-		return hclfmt.NewFormatter(), nil
-	case "proto":
-		return protofmt.NewFormatter(), nil
-	case "dart":
-		return cmdfmt.NewDartFormatter("dart"), nil
-	case "tf":
-		return cmdfmt.NewTerraformFormatter("terraform"), nil
+	return files, nil
+}
+
+func (me *Handler) Run(ctx context.Context) error {
+	switch me.Diagnostics {
+	case format.DiagnosticsText, format.DiagnosticsJSON, format.DiagnosticsSARIF:
 	default:
-		return nil, errors.New("invalid formatter")
+		return errors.Errorf("invalid diagnostics format: %q", me.Diagnostics)
+	}
+
+	switch me.Report {
+	case "":
+	case reportSARIF:
+		if !me.Check || me.Diff || me.Output != "" {
+			return errors.New("--report needs --check and cannot be used with --diff or --output")
+		}
+	default:
+		return errors.Errorf("invalid report format: %q", me.Report)
+	}
+
+	// stderr is reserved for machine readable diagnostics, so log messages,
+	// which go to stderr too, are dropped
+	if me.Diagnostics != format.DiagnosticsText {
+		ctx = zerolog.Nop().WithContext(ctx)
 	}
+
+	return me.reportDiagnostics(me.run(ctx))
 }
 
-func (me *Handler) Run(ctx context.Context) error {
-	fs := afero.NewOsFs()
+// reportDiagnostics writes the diagnostics of the files that failed to stderr
+// in the requested format, and returns a *ReportedError so they are not
+// printed twice. Errors without any diagnostics are returned as is.
+func (me *Handler) reportDiagnostics(err error) error {
+	var reported *ReportedError
+	if err == nil || errors.As(err, &reported) {
+		return err
+	}
+
+	diags, found := collectDiagnostics(err)
+	if !found {
+		return err
+	}
 
+	if werr := format.WriteDiagnostics(me.stderr, me.Diagnostics, diags); werr != nil {
+		return errors.Errorf("writing diagnostics: %w", werr)
+	}
+
+	return &ReportedError{Err: err}
+}
+
+// collectDiagnostics returns the diagnostics of every failed file, and whether
+// any error actually carried diagnostics rather than just a message.
+func collectDiagnostics(err error) ([]*format.Diagnostic, bool) {
+	errs := []error{err}
+	var merr *multierror.Error
+	if errors.As(err, &merr) {
+		errs = merr.Errors
+	}
+
+	found := false
+	diags := []*format.Diagnostic{}
+	for _, err := range errs {
+		filename := ""
+		var ferr *filesystem.FileError
+		if errors.As(err, &ferr) {
+			filename, err = ferr.Path, ferr.Err
+		}
+
+		var carrier format.DiagnosticsCarrier
+		if errors.As(err, &carrier) {
+			found = true
+		}
+		diags = append(diags, format.DiagnosticsFromError(filename, err)...)
+	}
+
+	return diags, found
+}
+
+func (me *Handler) run(ctx context.Context) error {
 	// Setup editorconfig with either raw content or auto-resolution
 	cfgProvider, err := editorconfig.NewDynamicConfigurationProvider(ctx, me.editorconfigContent)
 	if err != nil {
 		return errors.Errorf("creating configuration provider: %w", err)
 	}
 
-	fmtr, err := me.getFormatter(ctx)
+	switch me.Output {
+	case "":
+	case outputEditsJSON:
+		if me.Diff {
+			return errors.New("--diff and --output cannot be used together")
+		}
+	default:
+		return errors.Errorf("invalid output format: %q", me.Output)
+	}
+
+	if me.List && (me.Diff || me.Output != "" || me.ToStdout) {
+		return errors.New("--list cannot be used with --diff, --output or --stdout")
+	}
+
+	if me.Staged {
+		return me.runStaged(ctx, cfgProvider)
+	}
+
+	if me.FromStdin {
+		if len(me.filenames) != 1 {
+			return errors.New("exactly one filename is required when reading from stdin")
+		}
+
+		if me.reporting() {
+			return me.reportStdin(ctx, cfgProvider, me.filenames[0])
+		}
+
+		input, err := io.ReadAll(me.stdin)
+		if err != nil {
+			return errors.Errorf("reading stdin: %w", err)
+		}
+
+		output, err := me.formatBytes(ctx, cfgProvider, me.filenames[0], input)
+		if err != nil {
+			return err
+		}
+
+		_, err = me.stdout.Write(output)
+		return err
+	}
+
+	files, err := me.resolveFiles(ctx, cfgProvider)
 	if err != nil {
 		return err
 	}
 
-	var input io.Reader
-	if me.FromStdin {
-		input = os.Stdin
-	} else {
-		file, err := fs.Open(me.filename)
+	if me.reporting() {
+		return me.reportFiles(ctx, cfgProvider, files)
+	}
+
+	if me.ToStdout {
+		for _, filename := range files {
+			if err := me.formatToStdout(ctx, cfgProvider, filename); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	changed, err := filesystem.ForAllFilesAtSameTime(ctx, me.fs, files, me.Jobs, func(ctx context.Context, fle afero.File) (io.Reader, error) {
+		input, err := io.ReadAll(fle)
 		if err != nil {
-			return errors.Errorf("opening file: %w", err)
+			return nil, errors.Errorf("reading file: %w", err)
 		}
-		defer file.Close()
-		input = file
+
+		output, err := me.formatBytes(ctx, cfgProvider, fle.Name(), input)
+		if err != nil {
+			return nil, err
+		}
+
+		return bytes.NewReader(output), nil
+	})
+	if serr := me.summarize(changed, len(files)); serr != nil && err == nil {
+		err = serr
 	}
+	return err
+}
+
+// summarize prints the changed paths with --list, or otherwise a line like
+// "formatted 3 of 412 files" to stderr when diagnostics are written as text.
+func (me *Handler) summarize(changed []string, total int) error {
+	if me.List {
+		for _, filename := range changed {
+			if _, err := io.WriteString(me.stdout, filename+"\n"); err != nil {
+				return errors.Errorf("writing to stdout: %w", err)
+			}
+		}
+		return nil
+	}
+
+	// stderr is reserved for machine readable diagnostics
+	if me.Diagnostics != format.DiagnosticsText {
+		return nil
+	}
+
+	noun := "files"
+	if total == 1 {
+		noun = "file"
+	}
+	if _, err := fmt.Fprintf(me.stderr, "formatted %d of %d %s\n", len(changed), total, noun); err != nil {
+		return errors.Errorf("writing to stderr: %w", err)
+	}
+	return nil
+}
 
-	r, err := format.Format(ctx, fmtr, cfgProvider, me.filename, input)
+func (me *Handler) formatToStdout(ctx context.Context, cfgProvider format.ConfigurationProvider, filename string) error {
+	input, err := afero.ReadFile(me.fs, filename)
 	if err != nil {
-		return errors.Errorf("formatting content: %w", err)
+		return errors.Errorf("reading file: %w", err)
 	}
 
-	if me.ToStdout || me.FromStdin {
-		_, err = io.Copy(os.Stdout, r)
+	output, err := me.formatBytes(ctx, cfgProvider, filename, input)
+	if err != nil {
 		return err
 	}
 
-	err = afero.WriteReader(fs, me.filename, r)
+	_, err = me.stdout.Write(output)
+	return err
+}
+
+// reporting is true when the changes are printed or checked instead of written.
+func (me *Handler) reporting() bool {
+	return me.Check || me.Diff || me.Output != ""
+}
+
+// formatBytes formats the content in memory so the result can be compared with the input.
+func (me *Handler) formatBytes(ctx context.Context, cfgProvider format.ConfigurationProvider, filename string, input []byte) ([]byte, error) {
+	fmtr, err := me.getFormatter(ctx, cfgProvider, filename, input)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := format.Format(ctx, fmtr, cfgProvider, filename, bytes.NewReader(input))
+	if err != nil {
+		return nil, errors.Errorf("formatting content: %w", err)
+	}
+
+	output, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Errorf("reading formatted content: %w", err)
+	}
+
+	return output, nil
+}
+
+// fileChange is a file whose formatted content differs from its original content.
+type fileChange struct {
+	filename  string
+	original  []byte
+	formatted []byte
+}
+
+func (me *Handler) reportStdin(ctx context.Context, cfgProvider format.ConfigurationProvider, filename string) error {
+	input, err := io.ReadAll(me.stdin)
+	if err != nil {
+		return errors.Errorf("reading stdin: %w", err)
+	}
+
+	output, err := me.formatBytes(ctx, cfgProvider, filename, input)
 	if err != nil {
-		return errors.Errorf("writing formatted file: %w", err)
+		return me.report(nil, err)
+	}
+
+	changes := []*fileChange{}
+	if !bytes.Equal(input, output) {
+		changes = append(changes, &fileChange{filename, input, output})
+	}
+
+	return me.report(changes, nil)
+}
+
+// reportFiles formats every file without writing it and reports the files
+// whose content would change.
+func (me *Handler) reportFiles(ctx context.Context, cfgProvider format.ConfigurationProvider, files []string) error {
+	var mu sync.Mutex
+	changes := []*fileChange{}
+
+	_, err := filesystem.ForAllFilesAtSameTime(ctx, me.fs, files, me.Jobs, func(ctx context.Context, fle afero.File) (io.Reader, error) {
+		input, err := io.ReadAll(fle)
+		if err != nil {
+			return nil, errors.Errorf("reading file: %w", err)
+		}
+
+		output, err := me.formatBytes(ctx, cfgProvider, fle.Name(), input)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(input, output) {
+			mu.Lock()
+			changes = append(changes, &fileChange{fle.Name(), input, output})
+			mu.Unlock()
+		}
+
+		return nil, nil
+	})
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].filename < changes[j].filename
+	})
+
+	return me.report(changes, err)
+}
+
+// fileEdits is one line of the edits-json output.
+type fileEdits struct {
+	Path  string             `json:"path"`
+	Edits []*format.TextEdit `json:"edits"`
+}
+
+// report prints either a diff or the path of every changed file. Formatter
+// errors take precedence over an *UnformattedError in check mode.
+func (me *Handler) report(changes []*fileChange, formatErr error) error {
+	if me.Report == reportSARIF {
+		return me.reportSARIF(changes, formatErr)
+	}
+
+	for _, change := range changes {
+		out := change.filename + "\n"
+		switch {
+		case me.Diff:
+			out = format.UnifiedDiff(diffPath(change.filename), change.original, change.formatted)
+		case me.Output == outputEditsJSON:
+			line, err := json.Marshal(&fileEdits{
+				Path:  change.filename,
+				Edits: format.ComputeEdits(change.original, change.formatted),
+			})
+			if err != nil {
+				return errors.Errorf("encoding edits: %w", err)
+			}
+			out = string(line) + "\n"
+		}
+		if _, err := io.WriteString(me.stdout, out); err != nil {
+			return errors.Errorf("writing to stdout: %w", err)
+		}
+	}
+
+	if formatErr != nil {
+		return formatErr
+	}
+
+	return me.unformatted(changes)
+}
+
+// unformatted returns an *UnformattedError in check mode when files changed.
+func (me *Handler) unformatted(changes []*fileChange) error {
+	if me.Check && len(changes) > 0 {
+		files := make([]string, len(changes))
+		for i, change := range changes {
+			files[i] = change.filename
+		}
+		return &UnformattedError{Files: files}
 	}
 
 	return nil
 }
+
+// reportSARIF prints one result per unformatted file with a fix that formats
+// it, and one error result per parse error, as a single SARIF log on stdout.
+// Parse errors are returned as a *ReportedError so they are not written to
+// stderr as well.
+func (me *Handler) reportSARIF(changes []*fileChange, formatErr error) error {
+	results := []*format.SARIFResult{}
+	for _, change := range changes {
+		results = append(results, format.UnformattedToSARIF(diffPath(change.filename), change.original, change.formatted))
+	}
+
+	if formatErr != nil {
+		diags, _ := collectDiagnostics(formatErr)
+		for _, diag := range diags {
+			diag.File = diffPath(diag.File)
+		}
+		results = append(results, format.DiagnosticsToSARIF(diags)...)
+	}
+
+	if err := format.NewSARIFLog(results).Write(me.stdout); err != nil {
+		return errors.Errorf("writing sarif report: %w", err)
+	}
+
+	if formatErr != nil {
+		return &ReportedError{Err: formatErr}
+	}
+
+	return me.unformatted(changes)
+}
+
+// diffPath makes absolute paths relative to the working directory when
+// possible, so diff headers stay usable with `git apply`.
+func diffPath(filename string) string {
+	if !filepath.IsAbs(filename) {
+		return filename
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return filename
+	}
+
+	rel, err := filepath.Rel(wd, filename)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filename
+	}
+
+	return rel
+}
@@ -0,0 +1,249 @@
+package fmt_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fmtcmd "github.com/walteh/retab/v2/cmd/retab/fmt"
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+const editorconfig = "root = true\n\n[*]\nindent_style = tab\nindent_size = 4\n"
+
+// runFmt runs retab fmt against the in-memory filesystem and returns what it
+// wrote to stdout and stderr, where warnings are logged like in retab itself.
+func runFmt(t *testing.T, fs afero.Fs, stdin string, args ...string) (string, string, error) {
+	t.Helper()
+
+	cmd := fmtcmd.NewFmtCommandFs(fs)
+	cmd.SetArgs(append([]string{"--editorconfig-content", editorconfig}, args...))
+
+	var stdout, stderr bytes.Buffer
+	ctx := zerolog.New(&stderr).Level(zerolog.WarnLevel).WithContext(context.Background())
+	cmd.SetIn(strings.NewReader(stdin))
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	err := cmd.ExecuteContext(ctx)
+	return stdout.String(), stderr.String(), err
+}
+
+func newFs(t *testing.T, files map[string]string) afero.Fs {
+	t.Helper()
+
+	fs := afero.NewMemMapFs()
+	for filename, content := range files {
+		require.NoError(t, afero.WriteFile(fs, filename, []byte(content), 0o644))
+	}
+	return fs
+}
+
+func TestForcedFormatterSkipsUntargetedFiles(t *testing.T) {
+	fs := newFs(t, map[string]string{
+		"proj/main.hcl":      "a = 1\n",
+		"proj/README.md":     "# title\n\nnot = [hcl\n",
+		"proj/.editorconfig": "root = true\n",
+	})
+
+	stdout, _, err := runFmt(t, fs, "", "--formatter=hcl", "--check", "proj")
+	require.NoError(t, err, "walked files the formatter does not target should be skipped")
+	assert.Empty(t, stdout, "no file should be reported")
+
+	_, _, err = runFmt(t, fs, "", "--formatter=hcl", "--check", "proj/README.md")
+	require.Error(t, err, "files named explicitly should be formatted with the forced formatter")
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		stdout      string
+		unformatted []string
+		reported    bool
+		stderr      string
+	}{
+		{
+			name:  "formatted",
+			files: map[string]string{"proj/a.hcl": "a = 1\n"},
+		},
+		{
+			name:        "unformatted",
+			files:       map[string]string{"proj/a.hcl": "a = 1\n", "proj/b.hcl": "b=2\n", "proj/c.hcl": "c=3\n"},
+			stdout:      "proj/b.hcl\nproj/c.hcl\n",
+			unformatted: []string{"proj/b.hcl", "proj/c.hcl"},
+		},
+		{
+			name:     "parse_error_wins",
+			files:    map[string]string{"proj/b.hcl": "b=2\n", "proj/c.hcl": "c = {\n"},
+			stdout:   "proj/b.hcl\n",
+			reported: true,
+			stderr:   "proj/c.hcl:2:1: error: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFs(t, tt.files)
+
+			stdout, stderr, err := runFmt(t, fs, "", "--check", "proj")
+			assert.Equal(t, tt.stdout, stdout, "the unformatted files should be listed")
+
+			var unformatted *fmtcmd.UnformattedError
+			var reported *fmtcmd.ReportedError
+			switch {
+			case tt.reported:
+				require.ErrorAs(t, err, &reported, "formatter errors should fail as reported diagnostics")
+				assert.False(t, errors.As(err, &unformatted), "formatter errors should take precedence")
+				assert.Contains(t, stderr, tt.stderr, "the diagnostics should be written to stderr")
+			case tt.unformatted != nil:
+				require.ErrorAs(t, err, &unformatted, "unformatted files should fail the check")
+				assert.Equal(t, tt.unformatted, unformatted.Files, "the unformatted files should be reported")
+			default:
+				require.NoError(t, err, "formatted files should pass the check")
+			}
+
+			for filename, content := range tt.files {
+				written, err := afero.ReadFile(fs, filename)
+				require.NoError(t, err)
+				assert.Equal(t, content, string(written), "--check should not write %s", filename)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	fs := newFs(t, map[string]string{"proj/a.hcl": "a = 1\n", "proj/b.hcl": "a = 1\nb=2\n"})
+
+	stdout, _, err := runFmt(t, fs, "", "--diff", "proj")
+	require.NoError(t, err, "--diff should not fail without --check")
+	assert.Equal(t, "--- a/proj/b.hcl\n+++ b/proj/b.hcl\n@@ -1,2 +1,2 @@\n a = 1\n-b=2\n+b = 2\n", stdout, "the diff should match")
+
+	written, err := afero.ReadFile(fs, "proj/b.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, "a = 1\nb=2\n", string(written), "--diff should not write files")
+
+	stdout, _, err = runFmt(t, fs, "b=2\n", "--diff", "--stdin", "main.hcl")
+	require.NoError(t, err, "--diff should work with --stdin")
+	assert.Equal(t, "--- a/main.hcl\n+++ b/main.hcl\n@@ -1 +1 @@\n-b=2\n+b = 2\n", stdout, "the diff should use the given name")
+}
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		files  map[string]string
+		stdout string
+		stderr string
+	}{
+		{
+			name:   "summary",
+			files:  map[string]string{"proj/a.hcl": "a = 1\n", "proj/b.hcl": "b=2\n", "proj/c.hcl": "c=3\n"},
+			stderr: "formatted 2 of 3 files\n",
+		},
+		{
+			name:   "summary_one_file",
+			files:  map[string]string{"proj/a.hcl": "a = 1\n"},
+			stderr: "formatted 0 of 1 file\n",
+		},
+		{
+			name:   "list",
+			args:   []string{"--list"},
+			files:  map[string]string{"proj/a.hcl": "a = 1\n", "proj/b.hcl": "b=2\n", "proj/c.hcl": "c=3\n"},
+			stdout: "proj/b.hcl\nproj/c.hcl\n",
+		},
+		{
+			name:  "machine_readable_diagnostics",
+			args:  []string{"--diagnostics=json"},
+			files: map[string]string{"proj/b.hcl": "b=2\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFs(t, tt.files)
+
+			stdout, stderr, err := runFmt(t, fs, "", append(tt.args, "proj")...)
+			require.NoError(t, err, "formatting should succeed")
+			assert.Equal(t, tt.stdout, stdout, "stdout should match")
+			assert.Equal(t, tt.stderr, stderr, "stderr should match")
+
+			for filename := range tt.files {
+				written, err := afero.ReadFile(fs, filename)
+				require.NoError(t, err)
+				assert.NotRegexp(t, `\w=\w`, string(written), "%s should be formatted", filename)
+			}
+		})
+	}
+
+	_, _, err := runFmt(t, newFs(t, nil), "", "--list", "--diff", "proj")
+	assert.Error(t, err, "--list should not be combined with --diff")
+}
+
+func TestReportSARIF(t *testing.T) {
+	fs := newFs(t, map[string]string{"proj/a.hcl": "a = 1\n", "proj/b.hcl": "b=2\n", "proj/c.hcl": "c = {\n"})
+
+	stdout, stderr, err := runFmt(t, fs, "", "--check", "--report=sarif", "proj")
+
+	var reported *fmtcmd.ReportedError
+	require.ErrorAs(t, err, &reported, "parse errors should fail as already reported")
+	assert.Empty(t, stderr, "everything should be in the report")
+
+	log := &format.SARIFLog{}
+	require.NoError(t, json.Unmarshal([]byte(stdout), log), "the report should be a SARIF log")
+	require.Len(t, log.Runs, 1, "there should be one run")
+
+	results := log.Runs[0].Results
+	require.Len(t, results, 2, "there should be a result per unformatted file and parse error")
+
+	assert.Equal(t, format.SARIFRuleFormat, results[0].RuleID, "unformatted files should use the format rule")
+	assert.Equal(t, "proj/b.hcl", results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI, "uri should match")
+	require.Len(t, results[0].Fixes, 1, "unformatted files should have a fix")
+
+	assert.Equal(t, format.SARIFRuleParse, results[1].RuleID, "parse errors should use the parse rule")
+	assert.Equal(t, "error", results[1].Level, "parse errors should be errors")
+	assert.Equal(t, "proj/c.hcl", results[1].Locations[0].PhysicalLocation.ArtifactLocation.URI, "uri should match")
+
+	fs = newFs(t, map[string]string{"proj/b.hcl": "b=2\n"})
+	stdout, _, err = runFmt(t, fs, "", "--check", "--report=sarif", "proj")
+	var unformatted *fmtcmd.UnformattedError
+	require.ErrorAs(t, err, &unformatted, "unformatted files should fail the check")
+	assert.Contains(t, stdout, `"ruleId": "unformatted"`, "the report should still be written")
+
+	for _, args := range [][]string{
+		{"--report=sarif", "proj"},
+		{"--check", "--diff", "--report=sarif", "proj"},
+		{"--check", "--report=xml", "proj"},
+	} {
+		_, _, err := runFmt(t, fs, "", args...)
+		assert.Error(t, err, "%v should be rejected", args)
+	}
+}
+
+func TestMachineReadableDiagnosticsDropLogs(t *testing.T) {
+	const noisy = "root = true\n\n[*.txt]\nretab_external_command = sh -c 'echo careful >&2 && cat'\n"
+
+	for _, diagnostics := range []string{format.DiagnosticsText, format.DiagnosticsJSON, format.DiagnosticsSARIF} {
+		t.Run(diagnostics, func(t *testing.T) {
+			fs := newFs(t, map[string]string{"proj/a.txt": "a\n"})
+
+			_, stderr, err := runFmt(t, fs, "", "--editorconfig-content", noisy, "--diagnostics", diagnostics, "proj")
+			require.NoError(t, err, "formatting should succeed")
+
+			if diagnostics == format.DiagnosticsText {
+				assert.Contains(t, stderr, "external formatter wrote to stderr", "warnings should be logged with text diagnostics")
+				return
+			}
+			assert.Empty(t, stderr, "nothing but diagnostics should be written to stderr")
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package fmt
+
+import (
+	"bytes"
+	"context"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/afero"
+	"github.com/walteh/retab/v2/pkg/autoformat"
+	"github.com/walteh/retab/v2/pkg/filesystem"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/git"
+	"gitlab.com/tozd/go/errors"
+)
+
+// runStaged formats the staged content of every file in the git index that a
+// formatter targets, and writes the result to both the index and the working
+// tree. Unstaged changes in partially staged files are preserved by applying
+// only the formatting of the staged content as a patch on top of the working
+// tree copy.
+func (me *Handler) runStaged(ctx context.Context, cfgProvider format.ConfigurationProvider) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return errors.Errorf("getting working directory: %w", err)
+	}
+
+	repo, err := git.Open(ctx, wd)
+	if err != nil {
+		return errors.Errorf("opening git repository: %w", err)
+	}
+
+	staged, err := repo.StagedFiles(ctx, me.filenames...)
+	if err != nil {
+		return err
+	}
+
+	changes := []*fileChange{}
+	total := 0
+	for _, file := range staged {
+		filename := repo.Abs(file.Path)
+
+		ok, err := autoformat.Targeted(ctx, cfgProvider, me.formatter, filename)
+		if err != nil {
+			return errors.Errorf("resolving formatter for '%s': %w", file.Path, err)
+		}
+		if !ok {
+			continue
+		}
+		total++
+
+		original, err := repo.ReadStaged(ctx, file)
+		if err != nil {
+			return err
+		}
+
+		formatted, err := me.formatBytes(ctx, cfgProvider, filename, original)
+		if err != nil {
+			return errors.Errorf("formatting staged file '%s': %w", file.Path, err)
+		}
+
+		if bytes.Equal(original, formatted) {
+			continue
+		}
+
+		changes = append(changes, &fileChange{file.Path, original, formatted})
+
+		if me.reporting() {
+			continue
+		}
+
+		if err := me.writeStaged(ctx, repo, file, original, formatted); err != nil {
+			return err
+		}
+	}
+
+	if me.reporting() {
+		return me.report(changes, nil)
+	}
+
+	changed := make([]string, len(changes))
+	for i, change := range changes {
+		changed[i] = change.filename
+	}
+	return me.summarize(changed, total)
+}
+
+func (me *Handler) writeStaged(ctx context.Context, repo *git.Repository, file *git.StagedFile, original, formatted []byte) error {
+	filename := repo.Abs(file.Path)
+
+	worktree, err := afero.ReadFile(me.fs, filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// deleted in the working tree, only the index needs updating
+			return repo.WriteStaged(ctx, file, formatted)
+		}
+		return errors.Errorf("reading working tree file '%s': %w", file.Path, err)
+	}
+
+	if bytes.Equal(worktree, original) {
+		if err := repo.WriteStaged(ctx, file, formatted); err != nil {
+			return err
+		}
+		return me.writeWorktree(ctx, file, filename, formatted)
+	}
+
+	// the file is partially staged, so only the formatting of the staged
+	// content is applied, leaving the unstaged hunks as they are. The working
+	// tree is patched first so the index is left untouched when the formatting
+	// conflicts with the unstaged changes.
+	patch := format.UnifiedDiff(file.Path, original, formatted)
+	if err := repo.ApplyToWorktree(ctx, patch); err != nil {
+		return errors.Errorf("formatting of '%s' conflicts with its unstaged changes: %w", file.Path, err)
+	}
+
+	if err := repo.WriteStaged(ctx, file, formatted); err != nil {
+		return err
+	}
+
+	zerolog.Ctx(ctx).Info().Str("path", file.Path).Msg("formatted partially staged file")
+	return nil
+}
+
+func (me *Handler) writeWorktree(ctx context.Context, file *git.StagedFile, filename string, content []byte) error {
+	if _, err := filesystem.WriteFile(me.fs, filename, bytes.NewReader(content)); err != nil {
+		return errors.Errorf("writing working tree file '%s': %w", file.Path, err)
+	}
+
+	zerolog.Ctx(ctx).Info().Str("path", file.Path).Msg("formatted staged file")
+	return nil
+}
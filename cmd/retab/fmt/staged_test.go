@@ -0,0 +1,118 @@
+package fmt_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/git/gittest"
+)
+
+func readFile(t *testing.T, filename string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestStagedKeepsUnstagedChanges(t *testing.T) {
+	lines := []string{"a {", "\tb = 1", "}"}
+	for _, name := range []string{"e", "f", "g", "h", "i", "j", "k", "l"} {
+		lines = append(lines, name+" = 1")
+	}
+	lines = append(lines, "c {", "\td = 1", "}", "")
+	committed := strings.Join(lines, "\n")
+
+	dir := gittest.NewRepo(t, map[string]string{"x.hcl": committed})
+	gittest.Run(t, dir, "commit", "-q", "-m", "initial")
+	filename := filepath.Join(dir, "x.hcl")
+
+	staged := strings.Replace(committed, "\tb = 1", "  b = 2", 1)
+	gittest.WriteFile(t, filename, staged)
+	gittest.Run(t, dir, "add", "x.hcl")
+	gittest.WriteFile(t, filename, strings.Replace(staged, "\td = 1", "  d = 2", 1))
+
+	t.Chdir(dir)
+	_, _, err := runFmt(t, afero.NewOsFs(), "", "--staged")
+	require.NoError(t, err)
+
+	index := gittest.Run(t, dir, "show", ":x.hcl")
+	assert.Equal(t, strings.Replace(committed, "\tb = 1", "\tb = 2", 1), index, "the staged content should be formatted")
+
+	worktree := readFile(t, filename)
+	assert.Contains(t, worktree, "\tb = 2\n", "the staged change should be formatted in the working tree")
+	assert.Contains(t, worktree, "  d = 2\n", "the unstaged change should be left as is")
+}
+
+func TestStagedConflictWithUnstagedChanges(t *testing.T) {
+	dir := gittest.NewRepo(t, map[string]string{"x.hcl": "a = 1\n"})
+	gittest.Run(t, dir, "commit", "-q", "-m", "initial")
+	filename := filepath.Join(dir, "x.hcl")
+
+	gittest.WriteFile(t, filename, "a=2\n")
+	gittest.Run(t, dir, "add", "x.hcl")
+	gittest.WriteFile(t, filename, "a=3\n")
+
+	t.Chdir(dir)
+	_, _, err := runFmt(t, afero.NewOsFs(), "", "--staged")
+	require.Error(t, err, "formatting that conflicts with unstaged changes should fail")
+	assert.Contains(t, err.Error(), "conflicts with its unstaged changes", "the conflict should be explained")
+
+	assert.Equal(t, "a=2\n", gittest.Run(t, dir, "show", ":x.hcl"), "the index should be left untouched")
+	assert.Equal(t, "a=3\n", readFile(t, filename), "the working tree should be left untouched")
+}
+
+func TestStagedPathspecsRelativeToWorkingDirectory(t *testing.T) {
+	dir := gittest.NewRepo(t, map[string]string{"x.hcl": "a = 1\n", "sub/x.hcl": "a = 1\n"})
+	gittest.Run(t, dir, "commit", "-q", "-m", "initial")
+
+	gittest.WriteFile(t, filepath.Join(dir, "x.hcl"), "a=2\n")
+	gittest.WriteFile(t, filepath.Join(dir, "sub", "x.hcl"), "a=2\n")
+	gittest.Run(t, dir, "add", "-A")
+
+	t.Chdir(filepath.Join(dir, "sub"))
+	_, _, err := runFmt(t, afero.NewOsFs(), "", "--staged", "x.hcl")
+	require.NoError(t, err)
+
+	assert.Equal(t, "a = 2\n", readFile(t, filepath.Join(dir, "sub", "x.hcl")), "the file in the working directory should be formatted")
+	assert.Equal(t, "a=2\n", readFile(t, filepath.Join(dir, "x.hcl")), "the file at the root should be untouched")
+	assert.Equal(t, "a=2\n", gittest.Run(t, dir, "show", ":x.hcl"), "the root file should stay staged as is")
+}
+
+func TestStagedWritesThroughFilesystem(t *testing.T) {
+	dir := gittest.NewRepo(t, map[string]string{"x.hcl": "a = 1\n"})
+	gittest.Run(t, dir, "commit", "-q", "-m", "initial")
+	gittest.WriteFile(t, filepath.Join(dir, "x.hcl"), "a=2\n")
+	gittest.Run(t, dir, "add", "-A")
+
+	root, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	fs := newFs(t, map[string]string{filepath.Join(root, "x.hcl"): "a=2\n"})
+
+	t.Chdir(dir)
+	_, _, err = runFmt(t, fs, "", "--staged")
+	require.NoError(t, err)
+
+	written, err := afero.ReadFile(fs, filepath.Join(root, "x.hcl"))
+	require.NoError(t, err)
+	assert.Equal(t, "a = 2\n", string(written), "the working tree should be written through the filesystem")
+	assert.Equal(t, "a=2\n", readFile(t, filepath.Join(dir, "x.hcl")), "the file on disk should be untouched")
+	assert.Equal(t, "a = 2\n", gittest.Run(t, dir, "show", ":x.hcl"), "the index should be formatted")
+}
+
+func TestStagedReportsFormatterErrors(t *testing.T) {
+	dir := gittest.NewRepo(t, map[string]string{"x.hcl": "a = 1\n"})
+	gittest.Run(t, dir, "commit", "-q", "-m", "initial")
+	gittest.WriteFile(t, filepath.Join(dir, "x.hcl"), "a = 2\n")
+	gittest.Run(t, dir, "add", "-A")
+
+	t.Chdir(dir)
+	_, _, err := runFmt(t, afero.NewOsFs(), "", "--staged", "--formatter=nope")
+	require.Error(t, err, "an unknown formatter should not be mistaken for a file without one")
+	assert.Contains(t, err.Error(), "invalid formatter type", "the real error should be returned")
+}
@@ -0,0 +1,34 @@
+package lsp
+
+import (
+	"context"
+	"os"
+
+	"github.com/spf13/cobra"
+	lspserver "github.com/walteh/retab/v2/pkg/lsp"
+)
+
+type Handler struct {
+	version string
+}
+
+func NewLspCommand(version string) *cobra.Command {
+	me := &Handler{version: version}
+
+	cmd := &cobra.Command{
+		Use:   "lsp",
+		Short: "run a language server over stdio that formats documents and reports parse errors",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return me.Run(cmd.Context())
+	}
+
+	return cmd
+}
+
+func (me *Handler) Run(ctx context.Context) error {
+	// stdout belongs to the protocol, logs go to stderr
+	return lspserver.NewServer(me.version).Run(ctx, os.Stdin, os.Stdout)
+}
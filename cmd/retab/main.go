@@ -3,21 +3,47 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"runtime/debug"
+	"syscall"
 
+	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 	fmtcmd "github.com/walteh/retab/v2/cmd/retab/fmt"
+	lspcmd "github.com/walteh/retab/v2/cmd/retab/lsp"
+	whichcmd "github.com/walteh/retab/v2/cmd/retab/which"
+	"github.com/walteh/retab/v2/pkg/format/cmdfmt"
+	lspserver "github.com/walteh/retab/v2/pkg/lsp"
+	"gitlab.com/tozd/go/errors"
+)
+
+const (
+	// exitCodeUnformatted is returned when --check finds files that are not formatted
+	exitCodeUnformatted = 1
+	// exitCodeError is returned for any other failure, such as a formatter error
+	exitCodeError = 2
+	// exitCodeInterrupted is returned when retab is stopped by a signal
+	exitCodeInterrupted = 130
+	// exitCodeNoShutdown is returned by retab lsp when the client exits
+	// without shutting the server down first, as the protocol requires
+	exitCodeNoShutdown = 1
 )
 
 func main() {
-	ctx := context.Background()
+	// stops running external formatters on ctrl-c
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctx = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).Level(zerolog.WarnLevel).With().Timestamp().Logger().WithContext(ctx)
 
 	cmd := &cobra.Command{
 		Use: "retab",
 	}
 
 	cmd.AddCommand(fmtcmd.NewFmtCommand())
+	cmd.AddCommand(whichcmd.NewWhichCommand())
 
 	info, ok := debug.ReadBuildInfo()
 	if !ok {
@@ -26,6 +52,8 @@ func main() {
 		cmd.Version = info.Main.Version
 	}
 
+	cmd.AddCommand(lspcmd.NewLspCommand(cmd.Version))
+
 	cmdVersion := &cobra.Command{
 		Use: "raw-version",
 		Run: func(cmdz *cobra.Command, args []string) {
@@ -38,11 +66,44 @@ func main() {
 
 	cmd.InitDefaultVersionFlag()
 
-	// cmd.SilenceErrors = true
+	cmd.SilenceErrors = true
 	cmd.SilenceUsage = true
 
 	if err := cmd.ExecuteContext(ctx); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		stop()
+		os.Exit(reportError(os.Stderr, err))
+	}
+}
+
+// reportError writes the error to w, unless it was already written as
+// diagnostics, and returns the exit code for it.
+func reportError(w io.Writer, err error) int {
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(w, "interrupted")
+		return exitCodeInterrupted
 	}
+
+	var reported *fmtcmd.ReportedError
+	var timeout *cmdfmt.TimeoutError
+	switch {
+	case errors.As(err, &reported):
+		// diagnostics were already written in the requested format
+	case errors.As(err, &timeout):
+		fmt.Fprintf(w, "%s, the limit can be raised with retab_external_timeout in .editorconfig\n", err)
+		return exitCodeError
+	default:
+		fmt.Fprintln(w, err)
+	}
+
+	var unformatted *fmtcmd.UnformattedError
+	if errors.As(err, &unformatted) {
+		return exitCodeUnformatted
+	}
+
+	var noShutdown *lspserver.ExitWithoutShutdownError
+	if errors.As(err, &noShutdown) {
+		return exitCodeNoShutdown
+	}
+
+	return exitCodeError
 }
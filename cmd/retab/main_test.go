@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	fmtcmd "github.com/walteh/retab/v2/cmd/retab/fmt"
+	"github.com/walteh/retab/v2/pkg/format/cmdfmt"
+	lspserver "github.com/walteh/retab/v2/pkg/lsp"
+	"gitlab.com/tozd/go/errors"
+)
+
+func TestReportError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		code     int
+		contains string
+	}{
+		{
+			name:     "unformatted",
+			err:      &fmtcmd.UnformattedError{Files: []string{"a.hcl"}},
+			code:     exitCodeUnformatted,
+			contains: "1 file is not formatted",
+		},
+		{
+			name:     "formatter_error",
+			err:      errors.New("parse error"),
+			code:     exitCodeError,
+			contains: "parse error",
+		},
+		{
+			name: "reported",
+			err:  &fmtcmd.ReportedError{Err: errors.New("parse error")},
+			code: exitCodeError,
+		},
+		{
+			name:     "timeout",
+			err:      errors.Errorf("formatting a.dart: %w", &cmdfmt.TimeoutError{Command: "dart", Timeout: time.Second}),
+			code:     exitCodeError,
+			contains: "formatting a.dart: dart timed out after 1s, the limit can be raised",
+		},
+		{
+			name:     "lsp_exit_without_shutdown",
+			err:      &lspserver.ExitWithoutShutdownError{},
+			code:     exitCodeNoShutdown,
+			contains: "exit without shutdown",
+		},
+		{
+			name:     "interrupted",
+			err:      errors.Errorf("formatting: %w", context.Canceled),
+			code:     exitCodeInterrupted,
+			contains: "interrupted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.Equal(t, tt.code, reportError(&buf, tt.err), "exit code should match")
+
+			if tt.contains == "" {
+				assert.Empty(t, buf.String(), "reported errors should not be printed again")
+				return
+			}
+			assert.Contains(t, buf.String(), tt.contains, "output should describe the error")
+			assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("\n")), "the error should be printed once")
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package which
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/walteh/retab/v2/pkg/autoformat"
+	"github.com/walteh/retab/v2/pkg/format/editorconfig"
+	"gitlab.com/tozd/go/errors"
+)
+
+type Handler struct {
+	filenames           []string
+	editorconfigContent string
+}
+
+func NewWhichCommand() *cobra.Command {
+	me := &Handler{}
+
+	cmd := &cobra.Command{
+		Use:   "which file...",
+		Short: "print which formatter would handle each file and why",
+		Args:  cobra.MinimumNArgs(1),
+	}
+
+	cmd.Flags().StringVar(&me.editorconfigContent, "editorconfig-content", "", "editorconfig content (optional)")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		me.filenames = args
+		return me.Run(cmd.Context(), os.Stdout)
+	}
+
+	return cmd
+}
+
+func (me *Handler) Run(ctx context.Context, out io.Writer) error {
+	cfgProvider, err := editorconfig.NewDynamicConfigurationProvider(ctx, me.editorconfigContent)
+	if err != nil {
+		return errors.Errorf("creating configuration provider: %w", err)
+	}
+
+	for _, filename := range me.filenames {
+		// files that do not exist are explained by their name alone
+		content, err := os.ReadFile(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Errorf("reading '%s': %w", filename, err)
+		}
+
+		explanation, err := autoformat.ExplainFormatter(ctx, cfgProvider, filename, content)
+		if err != nil {
+			return errors.Errorf("explaining formatter for '%s': %w", filename, err)
+		}
+
+		if err := writeExplanation(out, filename, explanation); err != nil {
+			return errors.Errorf("writing explanation: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writeExplanation prints the formatter that handles the file on the first
+// line, followed by every registered formatter that matched it in order.
+func writeExplanation(out io.Writer, filename string, explanation *autoformat.Explanation) error {
+	detection := explanation.Detection
+
+	var err error
+	switch {
+	case explanation.Command != "":
+		_, err = fmt.Fprintf(out, "%s: external command %q from .editorconfig\n", filename, explanation.Command)
+	case detection.Winner() != nil:
+		_, err = fmt.Fprintf(out, "%s: %s\n", filename, detection.Winner().Name)
+	case explanation.Sniffed != nil:
+		_, err = fmt.Fprintf(out, "%s: %s, sniffed from the content\n", filename, explanation.Sniffed.Name)
+	default:
+		_, err = fmt.Fprintf(out, "%s: no formatter\n", filename)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, match := range detection.Matches {
+		_, err = fmt.Fprintf(out, "\t%s matched %q as %s (priority %d, specificity %d)\n",
+			match.Registration.Name, match.Target, detection.Path, match.Registration.Priority, match.Specificity)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
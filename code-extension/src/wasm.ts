@@ -10,8 +10,20 @@ declare global {
 		result: string;
 		error: string | undefined;
 	}
+	interface edit {
+		startLine: number;
+		startCol: number;
+		endLine: number;
+		endCol: number;
+		newText: string;
+	}
+	interface editsResult {
+		result: edit[];
+		error: string | undefined;
+	}
 	interface retab {
 		fmt: (formatter: RetabFormat, filename: string, fileContent: string, editorConfigContent: string) => result;
+		fmtEdits: (formatter: RetabFormat, filename: string, fileContent: string, editorConfigContent: string) => editsResult;
 	}
 
 	interface Go {
@@ -17,6 +17,96 @@ func (_m *MockConfiguration_format) EXPECT() *MockConfiguration_format_Expecter
 	return &MockConfiguration_format_Expecter{mock: &_m.Mock}
 }
 
+// Charset provides a mock function with no fields
+func (_m *MockConfiguration_format) Charset() string {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Charset")
+	}
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// MockConfiguration_format_Charset_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Charset'
+type MockConfiguration_format_Charset_Call struct {
+	*mock.Call
+}
+
+// Charset is a helper method to define mock.On call
+func (_e *MockConfiguration_format_Expecter) Charset() *MockConfiguration_format_Charset_Call {
+	return &MockConfiguration_format_Charset_Call{Call: _e.mock.On("Charset")}
+}
+
+func (_c *MockConfiguration_format_Charset_Call) Run(run func()) *MockConfiguration_format_Charset_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockConfiguration_format_Charset_Call) Return(_a0 string) *MockConfiguration_format_Charset_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockConfiguration_format_Charset_Call) RunAndReturn(run func() string) *MockConfiguration_format_Charset_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// EndOfLine provides a mock function with no fields
+func (_m *MockConfiguration_format) EndOfLine() string {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for EndOfLine")
+	}
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// MockConfiguration_format_EndOfLine_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'EndOfLine'
+type MockConfiguration_format_EndOfLine_Call struct {
+	*mock.Call
+}
+
+// EndOfLine is a helper method to define mock.On call
+func (_e *MockConfiguration_format_Expecter) EndOfLine() *MockConfiguration_format_EndOfLine_Call {
+	return &MockConfiguration_format_EndOfLine_Call{Call: _e.mock.On("EndOfLine")}
+}
+
+func (_c *MockConfiguration_format_EndOfLine_Call) Run(run func()) *MockConfiguration_format_EndOfLine_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockConfiguration_format_EndOfLine_Call) Return(_a0 string) *MockConfiguration_format_EndOfLine_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockConfiguration_format_EndOfLine_Call) RunAndReturn(run func() string) *MockConfiguration_format_EndOfLine_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // IndentSize provides a mock function with no fields
 func (_m *MockConfiguration_format) IndentSize() int {
 	ret := _m.Called()
@@ -62,6 +152,98 @@ func (_c *MockConfiguration_format_IndentSize_Call) RunAndReturn(run func() int)
 	return _c
 }
 
+// InsertFinalNewline provides a mock function with no fields
+func (_m *MockConfiguration_format) InsertFinalNewline() *bool {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for InsertFinalNewline")
+	}
+
+	var r0 *bool
+	if rf, ok := ret.Get(0).(func() *bool); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*bool)
+		}
+	}
+
+	return r0
+}
+
+// MockConfiguration_format_InsertFinalNewline_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'InsertFinalNewline'
+type MockConfiguration_format_InsertFinalNewline_Call struct {
+	*mock.Call
+}
+
+// InsertFinalNewline is a helper method to define mock.On call
+func (_e *MockConfiguration_format_Expecter) InsertFinalNewline() *MockConfiguration_format_InsertFinalNewline_Call {
+	return &MockConfiguration_format_InsertFinalNewline_Call{Call: _e.mock.On("InsertFinalNewline")}
+}
+
+func (_c *MockConfiguration_format_InsertFinalNewline_Call) Run(run func()) *MockConfiguration_format_InsertFinalNewline_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockConfiguration_format_InsertFinalNewline_Call) Return(_a0 *bool) *MockConfiguration_format_InsertFinalNewline_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockConfiguration_format_InsertFinalNewline_Call) RunAndReturn(run func() *bool) *MockConfiguration_format_InsertFinalNewline_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// MaxLineLength provides a mock function with no fields
+func (_m *MockConfiguration_format) MaxLineLength() int {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for MaxLineLength")
+	}
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func() int); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	return r0
+}
+
+// MockConfiguration_format_MaxLineLength_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'MaxLineLength'
+type MockConfiguration_format_MaxLineLength_Call struct {
+	*mock.Call
+}
+
+// MaxLineLength is a helper method to define mock.On call
+func (_e *MockConfiguration_format_Expecter) MaxLineLength() *MockConfiguration_format_MaxLineLength_Call {
+	return &MockConfiguration_format_MaxLineLength_Call{Call: _e.mock.On("MaxLineLength")}
+}
+
+func (_c *MockConfiguration_format_MaxLineLength_Call) Run(run func()) *MockConfiguration_format_MaxLineLength_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockConfiguration_format_MaxLineLength_Call) Return(_a0 int) *MockConfiguration_format_MaxLineLength_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockConfiguration_format_MaxLineLength_Call) RunAndReturn(run func() int) *MockConfiguration_format_MaxLineLength_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // OneBracketPerLine provides a mock function with no fields
 func (_m *MockConfiguration_format) OneBracketPerLine() bool {
 	ret := _m.Called()
@@ -152,6 +334,51 @@ func (_c *MockConfiguration_format_TrimMultipleEmptyLines_Call) RunAndReturn(run
 	return _c
 }
 
+// TrimTrailingWhitespace provides a mock function with no fields
+func (_m *MockConfiguration_format) TrimTrailingWhitespace() bool {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for TrimTrailingWhitespace")
+	}
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func() bool); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// MockConfiguration_format_TrimTrailingWhitespace_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'TrimTrailingWhitespace'
+type MockConfiguration_format_TrimTrailingWhitespace_Call struct {
+	*mock.Call
+}
+
+// TrimTrailingWhitespace is a helper method to define mock.On call
+func (_e *MockConfiguration_format_Expecter) TrimTrailingWhitespace() *MockConfiguration_format_TrimTrailingWhitespace_Call {
+	return &MockConfiguration_format_TrimTrailingWhitespace_Call{Call: _e.mock.On("TrimTrailingWhitespace")}
+}
+
+func (_c *MockConfiguration_format_TrimTrailingWhitespace_Call) Run(run func()) *MockConfiguration_format_TrimTrailingWhitespace_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockConfiguration_format_TrimTrailingWhitespace_Call) Return(_a0 bool) *MockConfiguration_format_TrimTrailingWhitespace_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockConfiguration_format_TrimTrailingWhitespace_Call) RunAndReturn(run func() bool) *MockConfiguration_format_TrimTrailingWhitespace_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // UseTabs provides a mock function with no fields
 func (_m *MockConfiguration_format) UseTabs() bool {
 	ret := _m.Called()
@@ -1,86 +1,242 @@
 package autoformat
 
 import (
+	"bytes"
 	"context"
 	"io"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 
-	"github.com/bmatcuk/doublestar/v4"
 	"github.com/walteh/retab/v2/pkg/format"
 	"github.com/walteh/retab/v2/pkg/format/cmdfmt"
-	"github.com/walteh/retab/v2/pkg/format/hclfmt"
-	"github.com/walteh/retab/v2/pkg/format/protofmt"
+
+	// builtin providers register themselves in format.DefaultRegistry
+	_ "github.com/walteh/retab/v2/pkg/format/hclfmt"
+	_ "github.com/walteh/retab/v2/pkg/format/protofmt"
 	"gitlab.com/tozd/go/errors"
 )
 
-// GetFormatter returns the appropriate formatter for the given format type and filename
+// GetFormatter returns the formatter registered under the format type, or
+// nil for "auto".
 func GetFormatter(formatType string) (format.Provider, error) {
-	var fmtr format.Provider
-
 	if formatType == "auto" {
 		return nil, nil // Caller should handle auto-detection
-	} else if formatType == "hcl" {
-		fmtr = hclfmt.NewFormatter()
-	} else if formatType == "proto" {
-		fmtr = protofmt.NewFormatter()
-	} else if formatType == "dart" {
-		fmtr = cmdfmt.NewDartFormatter("dart")
-	} else if formatType == "tf" {
-		fmtr = cmdfmt.NewTerraformFormatter("terraform")
-	} else {
-		return nil, errors.Errorf("invalid formatter type: %q", formatType)
 	}
 
-	return fmtr, nil
+	reg, err := format.DefaultRegistry.Lookup(formatType)
+	if err != nil {
+		return nil, err
+	}
+
+	return reg.Provider, nil
 }
 
-// AutoDetectFormatter attempts to find a suitable formatter based on the filename
+// AutoDetectFormatter attempts to find a suitable formatter based on the
+// path of the file relative to its project root.
 func AutoDetectFormatter(filename string) (format.Provider, error) {
-	pfmters := []format.Provider{
-		hclfmt.NewFormatter(),
-		protofmt.NewFormatter(),
-		cmdfmt.NewDartFormatter("dart"),
-		cmdfmt.NewTerraformFormatter("terraform"),
-	}
-
-	basename := filepath.Base(filename)
-	for _, pfmtr := range pfmters {
-		for _, target := range pfmtr.Targets() {
-			ok, err := doublestar.Match(target, basename)
-			if err != nil {
-				return nil, errors.Errorf("failed to match glob: %w", err)
-			}
-			if ok {
-				return pfmtr, nil
-			}
-		}
+	reg, err := format.DefaultRegistry.Detect(ProjectPath(filename))
+	if err != nil || reg == nil {
+		return nil, err
 	}
 
-	return nil, nil
+	return reg.Provider, nil
 }
 
-// FormatFile handles the common formatting logic for both CLI and WASM
-func FormatFile(ctx context.Context, formatType string, filename string, input io.Reader, cfg format.ConfigurationProvider) (io.Reader, error) {
-	var fmtr format.Provider
-	var err error
+// projectMarkers are the entries that mark the root of a project.
+var projectMarkers = []string{".git", ".retab"}
 
-	if formatType == "auto" {
-		fmtr, err = AutoDetectFormatter(filename)
-		if err != nil {
-			return nil, errors.Errorf("auto-detecting formatter: %w", err)
+// projectRoots caches the project root of every directory looked up until
+// InvalidateProjectRoots is called.
+var projectRoots sync.Map
+
+// IsProjectMarker reports whether the file marks the root of a project, so
+// changing it calls for InvalidateProjectRoots.
+func IsProjectMarker(filename string) bool {
+	return slices.Contains(projectMarkers, filepath.Base(filename))
+}
+
+// InvalidateProjectRoots drops the cached project roots, for long running
+// processes that see project markers come and go.
+func InvalidateProjectRoots() {
+	projectRoots.Clear()
+}
+
+// ProjectPath returns the path of the file relative to its project root,
+// which is the closest directory above it with a .git or .retab entry. Files
+// outside of a project are relative to the working directory, or left as is
+// when they are outside of that too.
+func ProjectPath(filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return filename
+	}
+
+	root := projectRoot(filepath.Dir(abs))
+	if root == "" {
+		if root, err = os.Getwd(); err != nil {
+			return filename
 		}
-	} else {
-		fmtr, err = GetFormatter(formatType)
-		if err != nil {
-			return nil, err
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filename
+	}
+
+	return rel
+}
+
+func projectRoot(dir string) string {
+	if root, ok := projectRoots.Load(dir); ok {
+		return root.(string)
+	}
+
+	root := ""
+	for _, marker := range projectMarkers {
+		if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+			root = dir
+			break
 		}
 	}
+	if parent := filepath.Dir(dir); root == "" && parent != dir {
+		root = projectRoot(parent)
+	}
+
+	projectRoots.Store(dir, root)
+	return root
+}
+
+// Explanation says which formatter handles a file in auto mode and why.
+type Explanation struct {
+	// Command is the external formatter declared in the configuration for
+	// the file, which takes precedence over the registered ones.
+	Command string
+	// Detection is how the registered formatters matched the file.
+	Detection *format.Detection
+	// Sniffed is the formatter picked from the content when no target
+	// matched and the content was given.
+	Sniffed *format.Registration
+}
+
+// ExplainFormatter explains the choice FindFormatter makes in auto mode.
+func ExplainFormatter(ctx context.Context, cfg format.ConfigurationProvider, filename string, content []byte) (*Explanation, error) {
+	efg, err := cfg.GetConfigurationForFileType(ctx, filename)
+	if err != nil {
+		return nil, errors.Errorf("getting configuration: %w", err)
+	}
+
+	explanation := &Explanation{}
+	if ext, ok := efg.(format.ExternalFormatterConfiguration); ok {
+		explanation.Command = strings.TrimSpace(ext.ExternalCommand())
+	}
+
+	explanation.Detection, err = format.DefaultRegistry.Explain(ProjectPath(filename))
+	if err != nil {
+		return nil, errors.Errorf("auto-detecting formatter: %w", err)
+	}
+
+	if explanation.Detection.Winner() == nil && content != nil {
+		explanation.Sniffed = format.DefaultRegistry.Sniff(content)
+	}
+
+	return explanation, nil
+}
+
+// ResolveFormatter returns the formatter for the file, or nil when none
+// applies. An explicit format type always wins. In auto mode an external
+// formatter declared in the configuration for the file takes precedence over
+// the builtin ones.
+func ResolveFormatter(ctx context.Context, cfg format.ConfigurationProvider, formatType string, filename string) (format.Provider, error) {
+	if formatType != "auto" {
+		return GetFormatter(formatType)
+	}
+
+	efg, err := cfg.GetConfigurationForFileType(ctx, filename)
+	if err != nil {
+		return nil, errors.Errorf("getting configuration: %w", err)
+	}
+
+	fmtr, err := cmdfmt.NewConfiguredFormatter(efg)
+	if err != nil {
+		return nil, errors.Errorf("building external formatter: %w", err)
+	}
+	if fmtr != nil {
+		return fmtr, nil
+	}
+
+	fmtr, err = AutoDetectFormatter(filename)
+	if err != nil {
+		return nil, errors.Errorf("auto-detecting formatter: %w", err)
+	}
+
+	return fmtr, nil
+}
+
+// Targeted reports whether the file is one to format when it is found by
+// walking a directory. In auto mode that is when ResolveFormatter finds a
+// formatter for it. An explicit format type handles any file it is given, so
+// the file must also match the targets of that formatter.
+func Targeted(ctx context.Context, cfg format.ConfigurationProvider, formatType string, filename string) (bool, error) {
+	if formatType == "auto" {
+		fmtr, err := ResolveFormatter(ctx, cfg, formatType, filename)
+		return fmtr != nil, err
+	}
+
+	reg, err := format.DefaultRegistry.Lookup(formatType)
+	if err != nil {
+		return false, err
+	}
+
+	return reg.Matches(ProjectPath(filename))
+}
+
+// SniffFormatter picks a formatter from the content, for files whose name
+// no formatter targets. It returns nil when the content is inconclusive too.
+func SniffFormatter(content []byte) format.Provider {
+	reg := format.DefaultRegistry.Sniff(content)
+	if reg == nil {
+		return nil
+	}
+	return reg.Provider
+}
+
+// FindFormatter is ResolveFormatter for callers that need a formatter, it
+// returns an error wrapping format.ErrNoFormatter when none applies. In auto
+// mode the content is sniffed when the file name is inconclusive, pass nil to
+// go by the name alone.
+func FindFormatter(ctx context.Context, cfg format.ConfigurationProvider, formatType string, filename string, content []byte) (format.Provider, error) {
+	fmtr, err := ResolveFormatter(ctx, cfg, formatType, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if fmtr == nil && content != nil {
+		fmtr = SniffFormatter(content)
+	}
 
 	if fmtr == nil {
-		return nil, errors.Errorf("no formatters found for file %q", filename)
+		return nil, errors.Errorf("%w for file %q", format.ErrNoFormatter, filename)
+	}
+
+	return fmtr, nil
+}
+
+// FormatFile handles the common formatting logic for both CLI and WASM
+func FormatFile(ctx context.Context, formatType string, filename string, input io.Reader, cfg format.ConfigurationProvider) (io.Reader, error) {
+	content, err := io.ReadAll(input)
+	if err != nil {
+		return nil, errors.Errorf("reading content: %w", err)
+	}
+
+	fmtr, err := FindFormatter(ctx, cfg, formatType, filename, content)
+	if err != nil {
+		return nil, err
 	}
 
-	r, err := format.Format(ctx, fmtr, cfg, filename, input)
+	r, err := format.Format(ctx, fmtr, cfg, filename, bytes.NewReader(content))
 	if err != nil {
 		return nil, errors.Errorf("formatting file: %w", err)
 	}
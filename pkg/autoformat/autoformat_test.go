@@ -0,0 +1,26 @@
+package autoformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/walteh/retab/v2/pkg/autoformat"
+)
+
+func TestProjectPathAfterInvalidation(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err, "resolving temp dir should succeed")
+
+	filename := filepath.Join(dir, "sub", "main.hcl")
+	require.Equal(t, filename, autoformat.ProjectPath(filename), "files outside of a project should keep their path")
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".retab"), 0o755), "creating project marker should succeed")
+	assert.True(t, autoformat.IsProjectMarker(filepath.Join(dir, ".retab")), ".retab should mark a project")
+
+	autoformat.InvalidateProjectRoots()
+	assert.Equal(t, filepath.Join("sub", "main.hcl"), autoformat.ProjectPath(filename), "new project marker should be found after invalidation")
+}
@@ -5,8 +5,12 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 	"sync"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/hashicorp/go-multierror"
 	"github.com/rs/zerolog"
 	"github.com/spf13/afero"
@@ -47,6 +51,8 @@ func (me *FSResolver) Run(ctx context.Context) (afero.Fs, afero.File, error) {
 	return res, fle, nil
 }
 
+// GetFileOrGlobDir returns the file itself, or every regular file below the
+// directory whose path (relative to that directory) matches the doublestar glob.
 func GetFileOrGlobDir(ctx context.Context, fs afero.Fs, fle afero.File, glob string) ([]string, error) {
 	isDir, err := afero.IsDir(fs, fle.Name())
 	if err != nil {
@@ -55,54 +61,199 @@ func GetFileOrGlobDir(ctx context.Context, fs afero.Fs, fle afero.File, glob str
 
 	fles := []string{}
 
-	if isDir {
-		flesd, err := afero.Glob(fs, glob)
+	if !isDir {
+		return append(fles, fle.Name()), nil
+	}
+
+	root := fle.Name()
+	err = afero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			return nil, err
+			return err
 		}
-		fles = append(fles, flesd...)
-	} else {
-		fles = append(fles, fle.Name())
+
+		if info.IsDir() {
+			if path != root && info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return errors.Errorf("getting relative path for '%s': %w", path, err)
+		}
+
+		ok, err := doublestar.Match(glob, filepath.ToSlash(rel))
+		if err != nil {
+			return errors.Errorf("matching glob '%s': %w", glob, err)
+		}
+
+		if ok {
+			fles = append(fles, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Errorf("walking directory '%s': %w", root, err)
 	}
 
+	zerolog.Ctx(ctx).Debug().Str("dir", root).Str("glob", glob).Int("count", len(fles)).Msg("resolved files in directory")
+
 	return fles, nil
 }
 
-func ForAllFilesAtSameTime(ctx context.Context, fls afero.Fs, files []string, cb func(ctx context.Context, fle afero.File) (io.Reader, error)) error {
-
-	grp := sync.WaitGroup{}
+// ExpandPaths resolves a list of files, directories and doublestar globs into
+// a sorted, de-duplicated list of regular files. Directories are walked
+// recursively.
+func ExpandPaths(ctx context.Context, fs afero.Fs, args []string) ([]string, error) {
+	seen := map[string]bool{}
+	fles := []string{}
 
-	var formatErrors *multierror.Error
-	for _, filename := range files {
-		grp.Add(1)
-		go func(filename string) {
-			defer grp.Done()
+	for _, arg := range args {
+		target, glob := arg, "**"
 
-			fle, err := fls.Open(filename)
-			if err != nil {
-				formatErrors = multierror.Append(formatErrors, errors.Errorf("failed to open file '%s': %w", filename, err))
-				return
+		if exists, err := afero.Exists(fs, arg); err != nil {
+			return nil, errors.Errorf("checking if '%s' exists: %w", arg, err)
+		} else if !exists {
+			if !strings.ContainsAny(arg, "*?[{") {
+				return nil, errors.Errorf("no such file or directory: '%s'", arg)
 			}
+			target, glob = doublestar.SplitPattern(filepath.ToSlash(arg))
+			target = filepath.FromSlash(target)
+		}
 
-			defer fle.Close()
+		fle, err := fs.Open(target)
+		if err != nil {
+			return nil, errors.Errorf("opening '%s': %w", target, err)
+		}
 
-			r, err := cb(ctx, fle)
-			if err != nil {
-				formatErrors = multierror.Append(formatErrors, errors.Errorf("failed to format file '%s': %w", filename, err))
-				return
+		matches, err := GetFileOrGlobDir(ctx, fs, fle, glob)
+		fle.Close()
+		if err != nil {
+			return nil, errors.Errorf("resolving files for '%s': %w", arg, err)
+		}
+
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				fles = append(fles, match)
 			}
+		}
+	}
 
-			err = afero.WriteReader(fls, filename, r)
-			if err != nil {
-				formatErrors = multierror.Append(formatErrors, errors.Errorf("failed to write formatted file '%s': %w", filename, err))
-				return
+	sort.Strings(fles)
+
+	return fles, nil
+}
+
+// FileError is the error of one file in ForAllFilesAtSameTime.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (me *FileError) Error() string {
+	return me.Err.Error()
+}
+
+func (me *FileError) Unwrap() error {
+	return me.Err
+}
+
+// ForAllFilesAtSameTime runs the callback for every file concurrently, with
+// at most jobs files in flight (GOMAXPROCS when jobs is not positive), and
+// writes the returned reader back to the file with WriteFile. A nil reader
+// means there is nothing to write. It returns the files whose content
+// changed, and the errors, both in the order of their paths. Every error is
+// a *FileError.
+func ForAllFilesAtSameTime(ctx context.Context, fls afero.Fs, files []string, jobs int, cb func(ctx context.Context, fle afero.File) (io.Reader, error)) ([]string, error) {
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+
+	// every file owns its slot, so workers never share anything
+	errs := make([]error, len(files))
+	written := make([]bool, len(files))
+
+	queue := make(chan int)
+	grp := sync.WaitGroup{}
+	for range min(jobs, len(files)) {
+		grp.Add(1)
+		go func() {
+			defer grp.Done()
+			for i := range queue {
+				var err error
+				written[i], err = forFile(ctx, fls, files[i], cb)
+				if err != nil {
+					errs[i] = &FileError{Path: files[i], Err: err}
+				}
 			}
+		}()
+	}
 
-			zerolog.Ctx(ctx).Info().Str("path", filename).Msg("formatted")
-		}(filename)
+	for i, filename := range files {
+		if ctx.Err() != nil {
+			errs[i] = &FileError{Path: filename, Err: errors.Errorf("failed to format file '%s': %w", filename, ctx.Err())}
+			continue
+		}
+		queue <- i
 	}
+	close(queue)
 
 	grp.Wait()
 
-	return formatErrors.ErrorOrNil()
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return files[order[a]] < files[order[b]]
+	})
+
+	changed := []string{}
+	var formatErrors *multierror.Error
+	for _, i := range order {
+		if written[i] {
+			changed = append(changed, files[i])
+		}
+		if errs[i] != nil {
+			formatErrors = multierror.Append(formatErrors, errs[i])
+		}
+	}
+
+	return changed, formatErrors.ErrorOrNil()
+}
+
+func forFile(ctx context.Context, fls afero.Fs, filename string, cb func(ctx context.Context, fle afero.File) (io.Reader, error)) (bool, error) {
+	fle, err := fls.Open(filename)
+	if err != nil {
+		return false, errors.Errorf("failed to open file '%s': %w", filename, err)
+	}
+
+	defer fle.Close()
+
+	r, err := cb(ctx, fle)
+	if err != nil {
+		return false, errors.Errorf("failed to format file '%s': %w", filename, err)
+	}
+
+	if r == nil {
+		return false, nil
+	}
+
+	written, err := WriteFile(fls, filename, r)
+	if err != nil {
+		return false, errors.Errorf("failed to write formatted file '%s': %w", filename, err)
+	}
+
+	if written {
+		zerolog.Ctx(ctx).Info().Str("path", filename).Msg("formatted")
+	}
+
+	return written, nil
 }
@@ -0,0 +1,156 @@
+package filesystem_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/filesystem"
+	"gitlab.com/tozd/go/errors"
+)
+
+func TestForAllFilesAtSameTime(t *testing.T) {
+	ctx := context.Background()
+	fs := afero.NewMemMapFs()
+
+	files := []string{"c.txt", "a.txt", "d.txt", "b.txt", "e.txt"}
+	for _, filename := range files {
+		require.NoError(t, afero.WriteFile(fs, filename, []byte(filename), 0o644))
+	}
+
+	var running, peak atomic.Int32
+	changed, err := filesystem.ForAllFilesAtSameTime(ctx, fs, files, 2, func(ctx context.Context, fle afero.File) (io.Reader, error) {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := peak.Load()
+			if now <= old || peak.CompareAndSwap(old, now) {
+				break
+			}
+		}
+
+		if fle.Name() != "a.txt" {
+			return nil, errors.New("broken")
+		}
+		return strings.NewReader("formatted"), nil
+	})
+	require.Error(t, err, "failing files should be reported")
+
+	assert.Equal(t, []string{"a.txt"}, changed, "only the formatted file should be reported as changed")
+	assert.LessOrEqual(t, peak.Load(), int32(2), "no more than the given number of files should be formatted at once")
+
+	var merr *multierror.Error
+	require.ErrorAs(t, err, &merr, "errors should be collected")
+	messages := []string{}
+	for _, err := range merr.Errors {
+		messages = append(messages, err.Error())
+	}
+	assert.Equal(t, []string{
+		"failed to format file 'b.txt': broken",
+		"failed to format file 'c.txt': broken",
+		"failed to format file 'd.txt': broken",
+		"failed to format file 'e.txt': broken",
+	}, messages, "errors should be ordered by path")
+
+	content, err := afero.ReadFile(fs, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "formatted", string(content), "the formatted file should be written")
+}
+
+func TestExpandPaths(t *testing.T) {
+	ctx := context.Background()
+	fs := afero.NewMemMapFs()
+
+	for _, filename := range []string{
+		"proj/main.hcl",
+		"proj/README.md",
+		"proj/deploy/prod/main.hcl",
+		"proj/deploy/prod/vars.tf",
+		"proj/.git/config.hcl",
+		"other/a.hcl",
+	} {
+		require.NoError(t, afero.WriteFile(fs, filename, []byte("a = 1\n"), 0o644))
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			name:     "file",
+			args:     []string{"proj/README.md"},
+			expected: []string{"proj/README.md"},
+		},
+		{
+			name:     "directory_skips_git",
+			args:     []string{"proj"},
+			expected: []string{"proj/README.md", "proj/deploy/prod/main.hcl", "proj/deploy/prod/vars.tf", "proj/main.hcl"},
+		},
+		{
+			name:     "glob",
+			args:     []string{"proj/**/*.hcl"},
+			expected: []string{"proj/deploy/prod/main.hcl", "proj/main.hcl"},
+		},
+		{
+			name:     "glob_in_directory",
+			args:     []string{"proj/deploy/*/*.tf"},
+			expected: []string{"proj/deploy/prod/vars.tf"},
+		},
+		{
+			name:     "sorted_without_duplicates",
+			args:     []string{"other", "proj/main.hcl", "proj/*.hcl"},
+			expected: []string{"other/a.hcl", "proj/main.hcl"},
+		},
+		{
+			name:     "glob_without_matches",
+			args:     []string{"proj/**/*.proto"},
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := filesystem.ExpandPaths(ctx, fs, tt.args)
+			require.NoError(t, err, "expanding paths should succeed")
+			assert.Equal(t, tt.expected, files, "files should match")
+		})
+	}
+
+	_, err := filesystem.ExpandPaths(ctx, fs, []string{"proj/missing.hcl"})
+	assert.Error(t, err, "missing files should be reported")
+}
+
+func TestGetFileOrGlobDir(t *testing.T) {
+	ctx := context.Background()
+	fs := afero.NewMemMapFs()
+
+	for _, filename := range []string{"dir/a.hcl", "dir/sub/b.hcl", "dir/sub/c.proto"} {
+		require.NoError(t, afero.WriteFile(fs, filename, []byte("a = 1\n"), 0o644))
+	}
+
+	open := func(name string) afero.File {
+		fle, err := fs.Open(name)
+		require.NoError(t, err)
+		t.Cleanup(func() { fle.Close() })
+		return fle
+	}
+
+	files, err := filesystem.GetFileOrGlobDir(ctx, fs, open("dir/a.hcl"), "**/*.proto")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir/a.hcl"}, files, "a file should be returned as is, whatever the glob")
+
+	files, err = filesystem.GetFileOrGlobDir(ctx, fs, open("dir"), "**/*.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir/a.hcl", "dir/sub/b.hcl"}, files, "the glob should match paths relative to the directory")
+
+	files, err = filesystem.GetFileOrGlobDir(ctx, fs, open("dir"), "sub/*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir/sub/b.hcl", "dir/sub/c.proto"}, files, "the glob should match paths relative to the directory")
+}
@@ -0,0 +1,118 @@
+package filesystem
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+	"gitlab.com/tozd/go/errors"
+)
+
+// maxSymlinks is how many links are followed before giving up on a loop.
+const maxSymlinks = 40
+
+// WriteFile replaces the content of the file without a window where it is
+// truncated. The content is written to a temporary file in the same
+// directory, synced and renamed over the original, keeping its mode.
+// Symlinks are resolved so their target is written instead of the link. The
+// file is left untouched when the content is unchanged. It reports whether
+// the file was written.
+func WriteFile(fs afero.Fs, filename string, r io.Reader) (bool, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return false, errors.Errorf("reading content: %w", err)
+	}
+
+	target, err := resolveSymlinks(fs, filename)
+	if err != nil {
+		return false, err
+	}
+
+	mode := os.FileMode(0o644)
+	info, err := fs.Stat(target)
+	switch {
+	case err == nil:
+		mode = info.Mode().Perm()
+
+		original, err := afero.ReadFile(fs, target)
+		if err != nil {
+			return false, errors.Errorf("reading '%s': %w", target, err)
+		}
+		if bytes.Equal(original, content) {
+			return false, nil
+		}
+	case !os.IsNotExist(err):
+		return false, errors.Errorf("reading file info for '%s': %w", target, err)
+	}
+
+	tmp, err := afero.TempFile(fs, filepath.Dir(target), "."+filepath.Base(target)+".retab-*")
+	if err != nil {
+		return false, errors.Errorf("creating temporary file: %w", err)
+	}
+
+	err = writeAndSync(tmp, content)
+	if err == nil {
+		err = fs.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = fs.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		_ = fs.Remove(tmp.Name())
+		return false, errors.Errorf("replacing '%s': %w", target, err)
+	}
+
+	return true, nil
+}
+
+func writeAndSync(fle afero.File, content []byte) error {
+	_, err := fle.Write(content)
+	if err == nil {
+		err = fle.Sync()
+	}
+	if cerr := fle.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// resolveSymlinks follows the file through any symlinks, for filesystems that
+// support them, and returns the path of the final target.
+func resolveSymlinks(fs afero.Fs, filename string) (string, error) {
+	lstater, ok := fs.(afero.Lstater)
+	if !ok {
+		return filename, nil
+	}
+	reader, ok := fs.(afero.LinkReader)
+	if !ok {
+		return filename, nil
+	}
+
+	for range maxSymlinks {
+		info, _, err := lstater.LstatIfPossible(filename)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filename, nil
+			}
+			return "", errors.Errorf("reading file info for '%s': %w", filename, err)
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			return filename, nil
+		}
+
+		link, err := reader.ReadlinkIfPossible(filename)
+		if err != nil {
+			return "", errors.Errorf("reading symlink '%s': %w", filename, err)
+		}
+
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(filename), link)
+		}
+		filename = link
+	}
+
+	return "", errors.Errorf("too many levels of symlinks for '%s'", filename)
+}
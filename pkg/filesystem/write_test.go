@@ -0,0 +1,74 @@
+package filesystem_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/filesystem"
+)
+
+func TestWriteFile(t *testing.T) {
+	fs := afero.NewOsFs()
+
+	t.Run("keeps_the_mode", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "run.sh")
+		require.NoError(t, os.WriteFile(filename, []byte("echo  hi\n"), 0o755))
+
+		written, err := filesystem.WriteFile(fs, filename, strings.NewReader("echo hi\n"))
+		require.NoError(t, err, "writing should succeed")
+		assert.True(t, written, "changed content should be written")
+
+		info, err := os.Stat(filename)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o755), info.Mode().Perm(), "the mode should be kept")
+
+		content, err := os.ReadFile(filename)
+		require.NoError(t, err)
+		assert.Equal(t, "echo hi\n", string(content), "content should be replaced")
+
+		entries, err := os.ReadDir(filepath.Dir(filename))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "no temporary file should be left behind")
+	})
+
+	t.Run("writes_through_symlinks", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "real.hcl")
+		link := filepath.Join(dir, "link.hcl")
+		require.NoError(t, os.WriteFile(target, []byte("a=1\n"), 0o644))
+		require.NoError(t, os.Symlink("real.hcl", link))
+
+		_, err := filesystem.WriteFile(fs, link, strings.NewReader("a = 1\n"))
+		require.NoError(t, err, "writing should succeed")
+
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		assert.NotZero(t, info.Mode()&os.ModeSymlink, "the link should stay a link")
+
+		content, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "a = 1\n", string(content), "the target should be written")
+	})
+
+	t.Run("unchanged_content_is_not_written", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "main.hcl")
+		require.NoError(t, os.WriteFile(filename, []byte("a = 1\n"), 0o644))
+
+		old := time.Now().Add(-time.Hour).Truncate(time.Second)
+		require.NoError(t, os.Chtimes(filename, old, old))
+
+		written, err := filesystem.WriteFile(fs, filename, strings.NewReader("a = 1\n"))
+		require.NoError(t, err, "writing should succeed")
+		assert.False(t, written, "unchanged content should not be written")
+
+		info, err := os.Stat(filename)
+		require.NoError(t, err)
+		assert.True(t, info.ModTime().Equal(old), "the modification time should not change")
+	})
+}
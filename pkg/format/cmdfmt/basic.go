@@ -1,9 +1,15 @@
 package cmdfmt
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/walteh/retab/v2/pkg/format"
@@ -13,31 +19,141 @@ import (
 type basicExternalFormatter struct {
 	indent  string
 	targets []string
-	f       func(io.Reader, io.Writer) func() error
+	f       func(context.Context, io.Reader, io.Writer) func() error
 }
 
+// DefaultTimeout is how long an exec formatter may run when its options do
+// not set a timeout.
+const DefaultTimeout = time.Minute
+
 type BasicExternalFormatterOpts struct {
 	Indent  string
 	Targets []string
+	// Timeout bounds each run of the command, zero means DefaultTimeout.
+	Timeout time.Duration
+}
+
+// TimeoutError is returned when an external formatter runs longer than its
+// timeout. The process is killed.
+type TimeoutError struct {
+	Command string
+	Timeout time.Duration
+}
+
+func (me *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", me.Command, me.Timeout)
+}
+
+// ExitError is returned when an external formatter exits with a non-zero
+// code. Its output is discarded.
+type ExitError struct {
+	Command  string
+	ExitCode int
+	Stderr   string
+}
+
+func (me *ExitError) Error() string {
+	if me.Stderr == "" {
+		return fmt.Sprintf("%s exited with code %d", me.Command, me.ExitCode)
+	}
+	return fmt.Sprintf("%s exited with code %d: %s", me.Command, me.ExitCode, me.Stderr)
 }
 
+// stderrPosition matches the "file:line:column: message" lines most tools
+// print their errors as, with an optional column and severity.
+var stderrPosition = regexp.MustCompile(`^[^:\s]*:(\d+):(?:(\d+):)?\s*(?:(error|warning):\s*)?(.+)$`)
+
+// Diagnostics reads the positions of the errors from stderr. Without any,
+// the whole error becomes a single diagnostic. The file name the tool
+// printed is dropped, it is a temporary file or stdin.
+func (me *ExitError) Diagnostics() []*format.Diagnostic {
+	diags := []*format.Diagnostic{}
+	for _, line := range strings.Split(me.Stderr, "\n") {
+		m := stderrPosition.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+
+		diag := &format.Diagnostic{Severity: format.SeverityError, Message: m[4], Source: me.Command}
+		diag.Line, _ = strconv.Atoi(m[1])
+		diag.Column, _ = strconv.Atoi(m[2])
+		if m[3] == "warning" {
+			diag.Severity = format.SeverityWarning
+		}
+		diags = append(diags, diag)
+	}
+
+	if len(diags) == 0 {
+		diags = append(diags, &format.Diagnostic{Severity: format.SeverityError, Message: me.Error(), Source: me.Command})
+	}
+
+	return diags
+}
+
+// NewExecFormatter runs the command with the content on stdin and reads the
+// formatted content from stdout. Anything the command writes to stderr is
+// logged as a warning, or returned as part of the error if it fails. The
+// process is killed when the context is done or the timeout passes.
 func NewExecFormatter(opts *BasicExternalFormatterOpts, cmds ...string) format.Provider {
-	return ExternalFormatterToProvider(&basicExternalFormatter{opts.Indent, opts.Targets, func(r io.Reader, w io.Writer) func() error {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return ExternalFormatterToProvider(&basicExternalFormatter{opts.Indent, opts.Targets, func(ctx context.Context, r io.Reader, w io.Writer) func() error {
 		if len(cmds) < 1 {
 			return func() error {
 				return errors.New("no command specified")
 			}
 		}
-		cmd := exec.Command(cmds[0], cmds[1:]...)
-		cmd.Stdin = r
-		cmd.Stdout = w
-		cmd.Stderr = w
-		return cmd.Run
+		return func() error {
+			return runCommand(ctx, timeout, cmds, r, w)
+		}
 	}})
 }
 
+// runCommand runs the command until it exits, the context is done or the
+// timeout passes. Stderr is logged as a warning on success and becomes part
+// of the error otherwise.
+func runCommand(ctx context.Context, timeout time.Duration, cmds []string, stdin io.Reader, stdout io.Writer) error {
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, cmds[0], cmds[1:]...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	// children that inherited the output would otherwise keep the killed
+	// command from returning
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return errors.Errorf("%s: %w", cmds[0], ctx.Err())
+	}
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Command: cmds[0], Timeout: timeout}
+	}
+	msg := strings.TrimSpace(stderr.String())
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{Command: cmds[0], ExitCode: exitErr.ExitCode(), Stderr: msg}
+	}
+	if err != nil {
+		if msg != "" {
+			return errors.Errorf("%s: %w: %s", cmds[0], err, msg)
+		}
+		return errors.Errorf("%s: %w", cmds[0], err)
+	}
+	if msg != "" {
+		zerolog.Ctx(ctx).Warn().Str("command", cmds[0]).Str("stderr", msg).Msg("external formatter wrote to stderr")
+	}
+	return nil
+}
+
 func NewNoopBasicExternalFormatProvider() format.Provider {
-	return ExternalFormatterToProvider(&basicExternalFormatter{"  ", []string{"*"}, func(r io.Reader, w io.Writer) func() error {
+	return ExternalFormatterToProvider(&basicExternalFormatter{"  ", []string{"*"}, func(_ context.Context, r io.Reader, w io.Writer) func() error {
 		return func() error {
 			_, err := io.Copy(w, r)
 			if err != nil {
@@ -54,12 +170,11 @@ var _ ExternalFormatter = (*basicExternalFormatter)(nil)
 func (me *basicExternalFormatter) Format(ctx context.Context, reader io.Reader) (io.Reader, func() error) {
 	zerolog.Ctx(ctx).Debug().Msg("running external formatter")
 	pipr, pipw := io.Pipe()
-	cmd := me.f(reader, pipw)
+	cmd := me.f(ctx, reader, pipw)
 	return pipr, func() error {
 		if err := cmd(); err != nil {
-			err := pipw.CloseWithError(err)
-			if err != nil {
-				return errors.Errorf("failed to close pipe: %w", err)
+			if cerr := pipw.CloseWithError(err); cerr != nil {
+				return errors.Errorf("failed to close pipe: %w", cerr)
 			}
 			return errors.Errorf("failed to run command: %w", err)
 		}
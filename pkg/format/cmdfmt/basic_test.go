@@ -0,0 +1,197 @@
+package cmdfmt_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mockery"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/format/cmdfmt"
+)
+
+// newConfig returns a configuration indenting with two spaces, which is all
+// the external formatters read from it.
+func newConfig(t *testing.T) *mockery.MockConfiguration_format {
+	cfg := mockery.NewMockConfiguration_format(t)
+	cfg.EXPECT().UseTabs().Return(false).Maybe()
+	cfg.EXPECT().IndentSize().Return(2).Maybe()
+	cfg.EXPECT().TrimMultipleEmptyLines().Return(false).Maybe()
+	return cfg
+}
+
+func TestExecFormatterStderr(t *testing.T) {
+	opts := &cmdfmt.BasicExternalFormatterOpts{Indent: "  ", Targets: []string{"*"}}
+
+	t.Run("stderr_is_not_part_of_the_output", func(t *testing.T) {
+		cfg := newConfig(t)
+
+		fmtr := cmdfmt.NewExecFormatter(opts, "sh", "-c", "echo 'deprecated flag' >&2; cat")
+
+		r, err := fmtr.Format(context.Background(), cfg, strings.NewReader("a\n  b\n"))
+		require.NoError(t, err, "formatting should succeed")
+
+		result, err := io.ReadAll(r)
+		require.NoError(t, err, "reading formatted content should succeed")
+		assert.Equal(t, "a\n  b\n", string(result), "output should only contain stdout")
+	})
+
+	t.Run("stderr_is_part_of_the_error", func(t *testing.T) {
+		cfg := newConfig(t)
+
+		fmtr := cmdfmt.NewExecFormatter(opts, "sh", "-c", "cat >/dev/null; echo 'syntax error on line 1' >&2; exit 3")
+
+		r, err := fmtr.Format(context.Background(), cfg, strings.NewReader("a\n"))
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		require.Error(t, err, "a failing command should be reported")
+		assert.Contains(t, err.Error(), "syntax error on line 1", "the error should include stderr")
+	})
+}
+
+func TestExecFormatterTimeout(t *testing.T) {
+	cfg := newConfig(t)
+
+	t.Run("timeout", func(t *testing.T) {
+		fmtr := cmdfmt.NewExecFormatter(&cmdfmt.BasicExternalFormatterOpts{Timeout: 100 * time.Millisecond}, "sleep", "10")
+
+		start := time.Now()
+		_, err := fmtr.Format(context.Background(), cfg, strings.NewReader("a\n"))
+		require.Error(t, err, "a hung command should fail")
+		assert.Less(t, time.Since(start), 5*time.Second, "the command should be killed")
+
+		var timeout *cmdfmt.TimeoutError
+		require.ErrorAs(t, err, &timeout, "the error should be a timeout")
+		assert.Equal(t, "sleep", timeout.Command, "command should match")
+		assert.Equal(t, 100*time.Millisecond, timeout.Timeout, "timeout should match")
+	})
+
+	t.Run("cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		fmtr := cmdfmt.NewExecFormatter(&cmdfmt.BasicExternalFormatterOpts{}, "sleep", "10")
+
+		start := time.Now()
+		_, err := fmtr.Format(ctx, cfg, strings.NewReader("a\n"))
+		require.Error(t, err, "a cancelled command should fail")
+		assert.Less(t, time.Since(start), 5*time.Second, "the command should be killed")
+		assert.ErrorIs(t, err, context.Canceled, "the error should be the cancellation")
+
+		var timeout *cmdfmt.TimeoutError
+		assert.False(t, errors.As(err, &timeout), "a cancellation is not a timeout")
+	})
+}
+
+func TestExecFormatterExitCode(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "fake-formatter")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+# echoes the input, then fails like a formatter that found a syntax error
+cat
+echo "line 3: unexpected token" >&2
+exit 3
+`), 0o755)
+	require.NoError(t, err, "writing the fake formatter should succeed")
+
+	cfg := newConfig(t)
+
+	fmtr := cmdfmt.NewExecFormatter(&cmdfmt.BasicExternalFormatterOpts{Indent: "  "}, script)
+
+	// the failure must be reported every time, not only when the goroutine
+	// running the command wins the race against reading its output
+	for range 20 {
+		r, err := fmtr.Format(context.Background(), cfg, strings.NewReader(strings.Repeat("a\n  b\n", 100)))
+		require.Error(t, err, "a non-zero exit should be reported")
+		assert.Nil(t, r, "partial output should not be returned")
+
+		var exit *cmdfmt.ExitError
+		require.ErrorAs(t, err, &exit, "the error should carry the exit status")
+		assert.Equal(t, script, exit.Command, "command should match")
+		assert.Equal(t, 3, exit.ExitCode, "exit code should match")
+		assert.Equal(t, "line 3: unexpected token", exit.Stderr, "stderr should match")
+		assert.NotContains(t, err.Error(), "failed to apply configuration", "the failure of the formatter should not be reported as a read error")
+	}
+}
+
+// lateFailingFormatter hands out its output right away and only fails once
+// it has been read, like a command that exits after flushing stdout.
+type lateFailingFormatter struct{}
+
+func (me *lateFailingFormatter) Format(_ context.Context, _ io.Reader) (io.Reader, func() error) {
+	return strings.NewReader("a\n"), func() error {
+		time.Sleep(10 * time.Millisecond)
+		return &cmdfmt.ExitError{Command: "late", ExitCode: 1}
+	}
+}
+
+func (me *lateFailingFormatter) Indent() string {
+	return ""
+}
+
+func (me *lateFailingFormatter) Targets() []string {
+	return []string{"*"}
+}
+
+func TestExternalFormatterFailsAfterOutput(t *testing.T) {
+	cfg := newConfig(t)
+
+	r, err := cmdfmt.ExternalFormatterToProvider(&lateFailingFormatter{}).Format(context.Background(), cfg, strings.NewReader("a\n"))
+	require.Error(t, err, "the failure should be reported even though all output was read")
+	assert.Nil(t, r, "output of a failed formatter should not be returned")
+
+	var exit *cmdfmt.ExitError
+	assert.ErrorAs(t, err, &exit, "the error should carry the exit status")
+}
+
+func TestExitErrorDiagnostics(t *testing.T) {
+	err := &cmdfmt.ExitError{Command: "dart", ExitCode: 65, Stderr: "line 1, column 2 of stdin: oops\n<stdin>:3:7: error: Expected ';'\n/tmp/x.dart:4: warning: unused"}
+
+	diags := err.Diagnostics()
+	require.Len(t, diags, 2, "lines with positions should become diagnostics")
+	assert.Equal(t, &format.Diagnostic{Line: 3, Column: 7, Severity: format.SeverityError, Message: "Expected ';'", Source: "dart"}, diags[0])
+	assert.Equal(t, &format.Diagnostic{Line: 4, Severity: format.SeverityWarning, Message: "unused", Source: "dart"}, diags[1])
+
+	diags = (&cmdfmt.ExitError{Command: "shfmt", ExitCode: 1, Stderr: "bad input"}).Diagnostics()
+	require.Len(t, diags, 1, "stderr without positions should become one diagnostic")
+	assert.Equal(t, "shfmt exited with code 1: bad input", diags[0].Message, "the message should be the whole error")
+}
+
+func TestExecFormatterLongLines(t *testing.T) {
+	opts := &cmdfmt.BasicExternalFormatterOpts{Indent: "  ", Targets: []string{"*"}}
+
+	t.Run("lines_over_64k_are_read", func(t *testing.T) {
+		cfg := newConfig(t)
+
+		line := strings.Repeat("a", 100_000)
+		fmtr := cmdfmt.NewExecFormatter(opts, "cat")
+
+		r, err := fmtr.Format(context.Background(), cfg, strings.NewReader(line+"\n"))
+		require.NoError(t, err, "formatting should succeed")
+
+		result, err := io.ReadAll(r)
+		require.NoError(t, err, "reading formatted content should succeed")
+		assert.Equal(t, line+"\n", string(result), "long line should be kept")
+	})
+
+	t.Run("too_long_line_is_reported", func(t *testing.T) {
+		cfg := newConfig(t)
+
+		fmtr := cmdfmt.NewExecFormatter(opts, "sh", "-c", "cat >/dev/null && head -c 20000000 /dev/zero | tr '\\0' a")
+
+		_, err := fmtr.Format(context.Background(), cfg, strings.NewReader("a\n"))
+		require.Error(t, err, "a line over the limit should fail")
+		assert.ErrorIs(t, err, bufio.ErrTooLong, "the read error should be reported instead of the broken pipe")
+
+		var exit *cmdfmt.ExitError
+		assert.False(t, errors.As(err, &exit), "the broken pipe of the formatter should not be reported")
+	})
+}
@@ -0,0 +1,128 @@
+package cmdfmt
+
+import (
+	"strings"
+	"time"
+
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+// NewConfiguredFormatter builds an exec formatter from the external formatter
+// declared in the configuration, for example with retab_external_command and
+// retab_external_indent in an .editorconfig section. Commands with a {file}
+// placeholder or declared in place get a file exec formatter. It returns nil
+// when the configuration does not declare one.
+func NewConfiguredFormatter(cfg format.Configuration) (format.Provider, error) {
+	ext, ok := cfg.(format.ExternalFormatterConfiguration)
+	if !ok || strings.TrimSpace(ext.ExternalCommand()) == "" {
+		return nil, nil
+	}
+
+	args, err := SplitCommand(ext.ExternalCommand())
+	if err != nil {
+		return nil, errors.Errorf("parsing external command: %w", err)
+	}
+
+	var timeout time.Duration
+	if raw := strings.TrimSpace(ext.ExternalTimeout()); raw != "" {
+		timeout, err = time.ParseDuration(raw)
+		if err != nil {
+			return nil, errors.Errorf("parsing external timeout: %w", err)
+		}
+		if timeout <= 0 {
+			return nil, errors.Errorf("external timeout must be positive, got %q", raw)
+		}
+	}
+
+	if ext.ExternalInPlace() || strings.Contains(ext.ExternalCommand(), FilePlaceholder) {
+		return NewFileExecFormatter(&FileExternalFormatterOpts{
+			Indent:  ext.ExternalIndent(),
+			Targets: []string{"*"},
+			Timeout: timeout,
+			InPlace: ext.ExternalInPlace(),
+		}, args...), nil
+	}
+
+	return NewExecFormatter(&BasicExternalFormatterOpts{
+		Indent:  ext.ExternalIndent(),
+		Targets: []string{"*"},
+		Timeout: timeout,
+	}, args...), nil
+}
+
+// SplitCommand splits a command line into arguments like a posix shell
+// would, honoring single quotes, double quotes and backslash escapes. Inside
+// double quotes a backslash only escapes $, `, ", \ and a newline, like in
+// the shell. Nothing is expanded.
+func SplitCommand(command string) ([]string, error) {
+	args := []string{}
+
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range command {
+		switch {
+		case escaped && quote == '"':
+			switch r {
+			case '$', '`', '"', '\\':
+				current.WriteRune(r)
+			case '\n':
+				// line continuation
+			default:
+				current.WriteRune('\\')
+				current.WriteRune(r)
+			}
+			escaped = false
+		case escaped:
+			// a newline is a line continuation
+			if r != '\n' {
+				current.WriteRune(r)
+				inArg = true
+			}
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if escaped {
+		return nil, errors.New("command ends with an escape")
+	}
+	if quote != 0 {
+		return nil, errors.Errorf("unterminated %c quote in command", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
@@ -0,0 +1,92 @@
+package cmdfmt_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mockery"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/format/cmdfmt"
+	"github.com/walteh/retab/v2/pkg/format/editorconfig"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		expected []string
+	}{
+		{name: "plain", command: "shfmt -i 2 -", expected: []string{"shfmt", "-i", "2", "-"}},
+		{name: "extra_whitespace", command: "  gofmt \t -s  ", expected: []string{"gofmt", "-s"}},
+		{name: "single_quotes", command: `sh -c 'tr a b'`, expected: []string{"sh", "-c", "tr a b"}},
+		{name: "double_quotes", command: `clang-format "--style={BasedOnStyle: llvm}"`, expected: []string{"clang-format", "--style={BasedOnStyle: llvm}"}},
+		{name: "escapes", command: `a\ b "c\"d"`, expected: []string{"a b", `c"d`}},
+		{name: "empty_argument", command: `fmt ''`, expected: []string{"fmt", ""}},
+		{name: "backslash_in_double_quotes", command: `sed "s/\./,/" "\$HOME" "a\\b"`, expected: []string{"sed", `s/\./,/`, "$HOME", `a\b`}},
+		{name: "backslash_in_single_quotes", command: `printf 'a\nb'`, expected: []string{"printf", `a\nb`}},
+		{name: "line_continuation", command: "fmt \\\n -s \"a\\\nb\"", expected: []string{"fmt", "-s", "ab"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := cmdfmt.SplitCommand(tt.command)
+			require.NoError(t, err, "splitting should succeed")
+			assert.Equal(t, tt.expected, args, "arguments should match")
+		})
+	}
+
+	_, err := cmdfmt.SplitCommand(`sh -c 'unterminated`)
+	assert.Error(t, err, "unterminated quotes should be reported")
+}
+
+func TestNewConfiguredFormatter(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := editorconfig.NewDynamicConfigurationProvider(ctx, `root = true
+[*.txt]
+indent_style = tab
+indent_size = 4
+retab_external_command = sh -c 'tr a-z A-Z'
+retab_external_indent = "  "
+`)
+	require.NoError(t, err, "parsing editorconfig should succeed")
+
+	cfg, err := provider.GetConfigurationForFileType(ctx, "notes.txt")
+	require.NoError(t, err, "getting configuration should succeed")
+
+	fmtr, err := cmdfmt.NewConfiguredFormatter(cfg)
+	require.NoError(t, err, "building the formatter should succeed")
+	require.NotNil(t, fmtr, "a formatter should be declared for txt files")
+
+	r, err := format.Format(ctx, fmtr, provider, "notes.txt", strings.NewReader("a\n  b\n"))
+	require.NoError(t, err, "formatting should succeed")
+
+	result, err := io.ReadAll(r)
+	require.NoError(t, err, "reading formatted content should succeed")
+	assert.Equal(t, "A\n\tB\n", string(result), "output should come from the command with tabs for indentation")
+}
+
+func TestNewConfiguredFormatterNotDeclared(t *testing.T) {
+	fmtr, err := cmdfmt.NewConfiguredFormatter(mockery.NewMockConfiguration_format(t))
+	require.NoError(t, err, "configurations without external formatters are fine")
+	assert.Nil(t, fmtr, "no formatter should be built")
+}
+
+func TestNewConfiguredFormatterInvalidTimeout(t *testing.T) {
+	provider, err := editorconfig.NewDynamicConfigurationProvider(context.Background(), `root = true
+[*.txt]
+retab_external_command = cat
+retab_external_timeout = soon
+`)
+	require.NoError(t, err, "parsing editorconfig should succeed")
+
+	cfg, err := provider.GetConfigurationForFileType(context.Background(), "notes.txt")
+	require.NoError(t, err, "getting configuration should succeed")
+
+	_, err = cmdfmt.NewConfiguredFormatter(cfg)
+	assert.Error(t, err, "an invalid timeout should be reported")
+}
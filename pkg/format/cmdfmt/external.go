@@ -38,15 +38,24 @@ func (me *externalStdinFormatter) Format(ctx context.Context, cfg format.Configu
 
 	read, f := me.internal.Format(ctx, input)
 
-	var rerr error
+	done := make(chan error, 1)
 	go func() {
-		if err := f(); err != nil {
-			rerr = err
-		}
+		done <- f()
 	}()
 
 	output, err := applyConfiguration(ctx, me.internal, cfg, read)
 	if err != nil {
+		// unblocks the formatter if it is still writing
+		if pr, ok := read.(*io.PipeReader); ok {
+			pr.CloseWithError(err)
+		}
+	}
+
+	// the formatter has always finished here. A failing formatter passes its
+	// error on through the pipe, any other read error, like a line too long
+	// to scan, is what made the formatter fail on a broken pipe and goes first
+	rerr := <-done
+	if err != nil && (rerr == nil || !errors.Is(err, errors.Unwrap(rerr))) {
 		return nil, errors.Errorf("failed to apply configuration: %w", err)
 	}
 
@@ -57,22 +66,14 @@ func (me *externalStdinFormatter) Format(ctx context.Context, cfg format.Configu
 	return output, nil
 }
 
-// type externalFileFormatter struct {
-// 	internal ExternalFileFormatter
-// 	fmter    ExternalFormatter
-// }
-
-// func (me *externalFileFormatter) Targets() []string {
-// 	return me.internal.Targets()
-// }
-
-// func ExternalFileFormatterToProvider(ext ExternalFormatter) format.Provider {
-// 	return &externalStdinFormatter{ext}
-// }
+// maxLineSize is the longest line read from an external formatter, well
+// above the default of bufio.Scanner for minified or generated files.
+const maxLineSize = 16 << 20
 
 func applyConfiguration(_ context.Context, ext ExternalFormatter, cfg format.Configuration, input io.Reader) (io.Reader, error) {
 	var output bytes.Buffer
 	scanner := bufio.NewScanner(input)
+	scanner.Buffer(nil, maxLineSize)
 	indentation := "\t"
 	if !cfg.UseTabs() {
 		indentation = strings.Repeat(" ", cfg.IndentSize())
@@ -88,7 +89,9 @@ func applyConfiguration(_ context.Context, ext ExternalFormatter, cfg format.Con
 		// }
 
 		// Apply indentation preference.
-		line = strings.Replace(line, ext.Indent(), indentation, -1)
+		if ext.Indent() != "" {
+			line = reindent(line, ext.Indent(), indentation)
+		}
 
 		// Trim multiple empty lines if configured.
 		if cfg.TrimMultipleEmptyLines() {
@@ -124,3 +127,27 @@ func applyConfiguration(_ context.Context, ext ExternalFormatter, cfg format.Con
 
 	return &output, nil
 }
+
+// reindent replaces the leading indentation of the line, counted in levels of
+// the formatter's indent unit, with the configured indentation. Tabs count as
+// one level each. Whatever is left of the leading whitespace, like the spaces
+// of an aligned continuation line, is kept as is, and nothing after the first
+// non-whitespace character is touched.
+func reindent(line string, unit string, indentation string) string {
+	content := strings.TrimLeft(line, " \t")
+	leading := line[:len(line)-len(content)]
+
+	levels := 0
+	for leading != "" {
+		if strings.HasPrefix(leading, unit) {
+			leading = leading[len(unit):]
+		} else if leading[0] == '\t' {
+			leading = leading[1:]
+		} else {
+			break
+		}
+		levels++
+	}
+
+	return strings.Repeat(indentation, levels) + leading + content
+}
@@ -0,0 +1,127 @@
+package cmdfmt
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+// FilePlaceholder is replaced with the path of the file to format in the
+// arguments of a file exec formatter.
+const FilePlaceholder = "{file}"
+
+type FileExternalFormatterOpts struct {
+	Indent  string
+	Targets []string
+	// Timeout bounds each run of the command, zero means DefaultTimeout.
+	Timeout time.Duration
+	// InPlace is set for commands that rewrite the file instead of printing
+	// the result to stdout.
+	InPlace bool
+}
+
+// NewFileExecFormatter is NewExecFormatter for tools that cannot read stdin.
+// The content is written to a temporary file next to the original, so the
+// tool finds the same configuration files, and its path replaces
+// FilePlaceholder in the arguments, or is appended when none has it. The
+// result is read from stdout, or from the file when the tool formats in
+// place. The temporary file is always removed.
+func NewFileExecFormatter(opts *FileExternalFormatterOpts, cmds ...string) format.Provider {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return ExternalFormatterToProvider(&basicExternalFormatter{opts.Indent, opts.Targets, func(ctx context.Context, r io.Reader, w io.Writer) func() error {
+		if len(cmds) < 1 {
+			return func() error {
+				return errors.New("no command specified")
+			}
+		}
+		return func() error {
+			path, err := writeTempFile(ctx, format.Filename(ctx), r)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := os.Remove(path); err != nil {
+					zerolog.Ctx(ctx).Warn().Err(err).Str("temp", path).Msg("removing temporary file")
+				}
+			}()
+
+			args := fileArgs(cmds, path)
+
+			if !opts.InPlace {
+				return runCommand(ctx, timeout, args, nil, w)
+			}
+
+			if err := runCommand(ctx, timeout, args, nil, io.Discard); err != nil {
+				return err
+			}
+
+			fle, err := os.Open(path)
+			if err != nil {
+				return errors.Errorf("opening formatted file: %w", err)
+			}
+			defer fle.Close()
+
+			if _, err := io.Copy(w, fle); err != nil {
+				return errors.Errorf("reading formatted file: %w", err)
+			}
+			return nil
+		}
+	}})
+}
+
+func fileArgs(cmds []string, path string) []string {
+	if !slices.ContainsFunc(cmds, func(arg string) bool { return strings.Contains(arg, FilePlaceholder) }) {
+		return append(slices.Clone(cmds), path)
+	}
+
+	args := make([]string, len(cmds))
+	for i, arg := range cmds {
+		args[i] = strings.ReplaceAll(arg, FilePlaceholder, path)
+	}
+	return args
+}
+
+// writeTempFile writes the content to a hidden file in the directory of the
+// original, keeping its extension so tools still recognize the language. It
+// falls back to the system temp directory when that is not possible, like
+// for stdin or read-only directories.
+func writeTempFile(ctx context.Context, filename string, r io.Reader) (string, error) {
+	dir, pattern := "", "retab-*"
+	if filename != "" {
+		ext := filepath.Ext(filename)
+		dir, pattern = filepath.Dir(filename), "."+strings.TrimSuffix(filepath.Base(filename), ext)+".retab-*"+ext
+	}
+
+	fle, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Str("path", filename).Msg("creating temporary file next to the original, using the temp directory")
+
+		fle, err = os.CreateTemp("", pattern)
+		if err != nil {
+			return "", errors.Errorf("creating temporary file: %w", err)
+		}
+	}
+
+	_, err = io.Copy(fle, r)
+	if cerr := fle.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(fle.Name())
+		return "", errors.Errorf("writing temporary file: %w", err)
+	}
+
+	return fle.Name(), nil
+}
@@ -0,0 +1,111 @@
+package cmdfmt_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/format/cmdfmt"
+	"github.com/walteh/retab/v2/pkg/format/editorconfig"
+)
+
+func TestFileExecFormatter(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := editorconfig.NewDynamicConfigurationProvider(ctx, `root = true
+[*.txt]
+indent_style = tab
+indent_size = 4
+`)
+	require.NoError(t, err, "parsing editorconfig should succeed")
+
+	t.Run("stdout", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "tool.cfg"), []byte("found\n"), 0o644))
+		filename := filepath.Join(dir, "notes.txt")
+
+		// the command only succeeds when run on a file next to its config
+		fmtr := cmdfmt.NewFileExecFormatter(&cmdfmt.FileExternalFormatterOpts{Indent: "  ", Targets: []string{"*"}},
+			"sh", "-c", `cat "$(dirname "$1")/tool.cfg" && tr a-z A-Z < "$1"`, "sh", "{file}")
+
+		r, err := format.Format(ctx, fmtr, provider, filename, strings.NewReader("a\n  b\n"))
+		require.NoError(t, err, "formatting should succeed")
+
+		result, err := io.ReadAll(r)
+		require.NoError(t, err, "reading formatted content should succeed")
+		assert.Equal(t, "found\nA\n\tB\n", string(result), "output should come from the command with tabs for indentation")
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err, "reading the directory should succeed")
+		assert.Len(t, entries, 1, "the temporary file should be removed")
+	})
+
+	t.Run("in_place", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "notes.txt")
+
+		fmtr := cmdfmt.NewFileExecFormatter(&cmdfmt.FileExternalFormatterOpts{Indent: "  ", Targets: []string{"*"}, InPlace: true},
+			"sh", "-c", `tr a-z A-Z < "$1" > "$1.out" && mv "$1.out" "$1" && echo ignored`, "sh")
+
+		r, err := format.Format(ctx, fmtr, provider, filename, strings.NewReader("a\n  b\n"))
+		require.NoError(t, err, "formatting should succeed")
+
+		result, err := io.ReadAll(r)
+		require.NoError(t, err, "reading formatted content should succeed")
+		assert.Equal(t, "A\n\tB\n", string(result), "output should be read back from the file")
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err, "reading the directory should succeed")
+		assert.Empty(t, entries, "the temporary file should be removed")
+	})
+
+	t.Run("failure_removes_the_file", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "notes.txt")
+
+		fmtr := cmdfmt.NewFileExecFormatter(&cmdfmt.FileExternalFormatterOpts{Targets: []string{"*"}}, "sh", "-c", "exit 2", "sh", "{file}")
+
+		_, err := format.Format(ctx, fmtr, provider, filename, strings.NewReader("a\n"))
+		require.Error(t, err, "a failing command should be reported")
+
+		var exit *cmdfmt.ExitError
+		require.ErrorAs(t, err, &exit, "the error should carry the exit code")
+		assert.Equal(t, 2, exit.ExitCode, "exit code should match")
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err, "reading the directory should succeed")
+		assert.Empty(t, entries, "the temporary file should be removed")
+	})
+}
+
+func TestNewConfiguredFormatterFilePlaceholder(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := editorconfig.NewDynamicConfigurationProvider(ctx, `root = true
+[*.txt]
+indent_style = tab
+retab_external_command = sh -c 'tr a-z A-Z < "$1"' sh {file}
+retab_external_indent = "  "
+`)
+	require.NoError(t, err, "parsing editorconfig should succeed")
+
+	cfg, err := provider.GetConfigurationForFileType(ctx, "notes.txt")
+	require.NoError(t, err, "getting configuration should succeed")
+
+	fmtr, err := cmdfmt.NewConfiguredFormatter(cfg)
+	require.NoError(t, err, "building the formatter should succeed")
+	require.NotNil(t, fmtr, "a formatter should be declared for txt files")
+
+	r, err := format.Format(ctx, fmtr, provider, filepath.Join(t.TempDir(), "notes.txt"), strings.NewReader("a\n  b\n"))
+	require.NoError(t, err, "formatting should succeed")
+
+	result, err := io.ReadAll(r)
+	require.NoError(t, err, "reading formatted content should succeed")
+	assert.Equal(t, "A\n\tB\n", string(result), "output should come from the command run on the file")
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/walteh/retab/v2/gen/mockery"
 	"github.com/walteh/retab/v2/pkg/format/cmdfmt"
 )
@@ -341,3 +342,69 @@ class _MyHomePageState extends State<MyHomePage> {
 		})
 	}
 }
+
+func TestReindentation(t *testing.T) {
+	tests := []struct {
+		name       string
+		useTabs    bool
+		indentSize int
+		src        string
+		expected   string
+	}{
+		{
+			name:     "leading_indent_levels",
+			useTabs:  true,
+			src:      "a\n  b\n    c\n",
+			expected: "a\n\tb\n\t\tc\n",
+		},
+		{
+			name:     "string_literals_are_kept",
+			useTabs:  true,
+			src:      "  x = \"a  b\"\n",
+			expected: "\tx = \"a  b\"\n",
+		},
+		{
+			name:     "comments_and_tables_are_kept",
+			useTabs:  true,
+			src:      "  // a  b\n  key    = 1\n  longer = 2\n",
+			expected: "\t// a  b\n\tkey    = 1\n\tlonger = 2\n",
+		},
+		{
+			name:     "odd_alignment_keeps_remainder",
+			useTabs:  true,
+			src:      "  call(a,\n       b)\n",
+			expected: "\tcall(a,\n\t\t\t b)\n",
+		},
+		{
+			name:     "tabs_count_as_levels",
+			useTabs:  true,
+			src:      "\t  a\n",
+			expected: "\t\ta\n",
+		},
+		{
+			name:       "spaces",
+			useTabs:    false,
+			indentSize: 4,
+			src:        "a\n  b\n     c  d\n",
+			expected:   "a\n    b\n         c  d\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mockery.NewMockConfiguration_format(t)
+			cfg.EXPECT().UseTabs().Return(tt.useTabs)
+			cfg.EXPECT().IndentSize().Return(tt.indentSize).Maybe()
+			cfg.EXPECT().TrimMultipleEmptyLines().Return(false)
+
+			result, err := cmdfmt.NewNoopExternalFormatProvider().Format(context.Background(), cfg, bytes.NewReader([]byte(tt.src)))
+			require.NoError(t, err, "formatting should succeed")
+
+			buf := new(bytes.Buffer)
+			_, err = buf.ReadFrom(result)
+			require.NoError(t, err, "reading formatted content should succeed")
+
+			assert.Equal(t, tt.expected, buf.String(), "only leading indentation should change")
+		})
+	}
+}
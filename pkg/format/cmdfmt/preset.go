@@ -4,6 +4,10 @@ import (
 	"github.com/walteh/retab/v2/pkg/format"
 )
 
+func init() {
+	format.MustRegister(&format.Registration{Name: "dart", Provider: NewDartFormatter("dart")})
+}
+
 func NewDartFormatter(cmds ...string) format.Provider {
 	cmds = append(cmds, "format", "--output", "show", "--summary", "none", "--fix")
 
@@ -13,6 +17,8 @@ func NewDartFormatter(cmds ...string) format.Provider {
 	}, cmds...)
 }
 
+// NewTerraformFormatter shells out to `terraform fmt`. The hclfmt package has
+// a native terraform formatter that does not need the binary.
 func NewTerraformFormatter(cmds ...string) format.Provider {
 	cmds = append(cmds, "fmt", "-write=false", "-list=false")
 
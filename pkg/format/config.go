@@ -6,6 +6,9 @@ import (
 	"text/tabwriter"
 )
 
+// DefaultIndentSize is used when neither indent_size nor tab_width is set.
+const DefaultIndentSize = 4
+
 type ConfigurationProvider interface {
 	GetConfigurationForFileType(ctx context.Context, filename string) (Configuration, error)
 }
@@ -15,6 +18,35 @@ type Configuration interface {
 	IndentSize() int
 	TrimMultipleEmptyLines() bool
 	OneBracketPerLine() bool
+	// MaxLineLength is the column limit formatters should wrap at, or 0 when
+	// lines are not limited.
+	MaxLineLength() int
+	// EndOfLine is "lf", "crlf", "cr" or empty to keep the line endings.
+	EndOfLine() string
+	// InsertFinalNewline is nil when the final newline is left as is.
+	InsertFinalNewline() *bool
+	TrimTrailingWhitespace() bool
+	// Charset is "utf-8", "utf-8-bom", "latin1", "utf-16be", "utf-16le" or
+	// empty for utf-8 content that is left as is.
+	Charset() string
+}
+
+// ExternalFormatterConfiguration is implemented by configurations that can
+// declare an external command to format a file with.
+type ExternalFormatterConfiguration interface {
+	// ExternalCommand is the command line of the formatter, or empty when
+	// none is declared. The content is passed on stdin and read from stdout,
+	// unless the command has a {file} placeholder.
+	ExternalCommand() string
+	// ExternalIndent is the indentation the command produces, which is
+	// replaced with the configured one. Empty leaves the output alone.
+	ExternalIndent() string
+	// ExternalTimeout is how long the command may run, as a duration like
+	// "30s". Empty uses the default.
+	ExternalTimeout() string
+	// ExternalInPlace is set when the command rewrites the file given by the
+	// {file} placeholder instead of printing the result.
+	ExternalInPlace() bool
 }
 
 func BuildTabWriter(cfg Configuration, writer io.Writer) *tabwriter.Writer {
@@ -26,6 +58,11 @@ type basicConfigurationProvider struct {
 	indentSize             int
 	trimMultipleEmptyLines bool
 	oneBracketPerLine      bool
+	maxLineLength          int
+	endOfLine              string
+	insertFinalNewline     *bool
+	trimTrailingWhitespace bool
+	charset                string
 }
 
 func (x *basicConfigurationProvider) UseTabs() bool {
@@ -45,6 +82,32 @@ func (x *basicConfigurationProvider) OneBracketPerLine() bool {
 	return x.oneBracketPerLine
 }
 
+func (x *basicConfigurationProvider) MaxLineLength() int {
+	return x.maxLineLength
+}
+
+func (x *basicConfigurationProvider) EndOfLine() string {
+	return x.endOfLine
+}
+
+func (x *basicConfigurationProvider) InsertFinalNewline() *bool {
+	return x.insertFinalNewline
+}
+
+func (x *basicConfigurationProvider) TrimTrailingWhitespace() bool {
+	return x.trimTrailingWhitespace
+}
+
+func (x *basicConfigurationProvider) Charset() string {
+	return x.charset
+}
+
+// DefaultConfiguration is used for files no .editorconfig applies to: tabs
+// with a size of 4, multiple empty lines trimmed and one bracket per line.
+func DefaultConfiguration() Configuration {
+	return NewBasicConfigurationProvider(true, DefaultIndentSize, true, true)
+}
+
 func NewBasicConfigurationProvider(tabs bool, indentSize int, trimMultipleEmptyLines bool, onebracket bool) Configuration {
 	return &basicConfigurationProvider{
 		tabs:                   tabs,
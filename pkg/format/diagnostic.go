@@ -0,0 +1,159 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a problem found in a file, like a parse error. Lines and
+// columns are one-based, zero means the position is unknown.
+type Diagnostic struct {
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+	EndLine   int      `json:"endLine,omitempty"`
+	EndColumn int      `json:"endColumn,omitempty"`
+	Severity  Severity `json:"severity"`
+	Message   string   `json:"message"`
+	// Source is what found the problem, "hcl" or "proto" for the native
+	// parsers and the command for external formatters.
+	Source string `json:"source,omitempty"`
+}
+
+func (me *Diagnostic) String() string {
+	var b strings.Builder
+	if me.File != "" {
+		b.WriteString(me.File + ":")
+	}
+	if me.Line > 0 {
+		b.WriteString(strconv.Itoa(me.Line) + ":")
+		if me.Column > 0 {
+			b.WriteString(strconv.Itoa(me.Column) + ":")
+		}
+	}
+	if b.Len() > 0 {
+		b.WriteString(" ")
+	}
+	b.WriteString(string(me.Severity) + ": " + me.Message)
+	return b.String()
+}
+
+// DiagnosticsCarrier is implemented by errors that can describe themselves
+// as diagnostics.
+type DiagnosticsCarrier interface {
+	Diagnostics() []*Diagnostic
+}
+
+// DiagnosticsError is returned by providers when the content does not parse.
+type DiagnosticsError struct {
+	List []*Diagnostic
+	// Err is the error of the parser, like hcl.Diagnostics, if any.
+	Err error
+}
+
+func (me *DiagnosticsError) Error() string {
+	if len(me.List) == 0 {
+		if me.Err != nil {
+			return me.Err.Error()
+		}
+		return "invalid content"
+	}
+
+	msg := me.List[0].String()
+	if len(me.List) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(me.List)-1)
+	}
+	return msg
+}
+
+func (me *DiagnosticsError) Unwrap() error {
+	return me.Err
+}
+
+func (me *DiagnosticsError) Diagnostics() []*Diagnostic {
+	return me.List
+}
+
+// withFilename turns errors carrying diagnostics into a *DiagnosticsError
+// whose diagnostics name the file, so callers no longer need to know which
+// file failed. Other errors are returned as is.
+func withFilename(err error, filename string) error {
+	var carrier DiagnosticsCarrier
+	if !errors.As(err, &carrier) {
+		return err
+	}
+
+	diags := []*Diagnostic{}
+	for _, diag := range carrier.Diagnostics() {
+		diag := *diag
+		if diag.File == "" {
+			diag.File = filename
+		}
+		diags = append(diags, &diag)
+	}
+
+	return &DiagnosticsError{List: diags, Err: err}
+}
+
+// DiagnosticsFromError returns the diagnostics carried by the error, or a
+// single diagnostic without a position holding its message.
+func DiagnosticsFromError(filename string, err error) []*Diagnostic {
+	var carrier DiagnosticsCarrier
+	if errors.As(err, &carrier) && len(carrier.Diagnostics()) > 0 {
+		diags := []*Diagnostic{}
+		for _, diag := range carrier.Diagnostics() {
+			diag := *diag
+			if diag.File == "" {
+				diag.File = filename
+			}
+			diags = append(diags, &diag)
+		}
+		return diags
+	}
+
+	return []*Diagnostic{{File: filename, Severity: SeverityError, Message: err.Error()}}
+}
+
+const (
+	DiagnosticsText  = "text"
+	DiagnosticsJSON  = "json"
+	DiagnosticsSARIF = "sarif"
+)
+
+// WriteDiagnostics renders the diagnostics as "file:line:column: severity:
+// message" lines, as one json object per line, or as a SARIF log.
+func WriteDiagnostics(w io.Writer, style string, diags []*Diagnostic) error {
+	switch style {
+	case DiagnosticsText, "":
+		for _, diag := range diags {
+			if _, err := io.WriteString(w, diag.String()+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	case DiagnosticsJSON:
+		enc := json.NewEncoder(w)
+		for _, diag := range diags {
+			if err := enc.Encode(diag); err != nil {
+				return errors.Errorf("encoding diagnostic: %w", err)
+			}
+		}
+		return nil
+	case DiagnosticsSARIF:
+		return NewSARIFLog(DiagnosticsToSARIF(diags)).Write(w)
+	default:
+		return errors.Errorf("invalid diagnostics format: %q", style)
+	}
+}
@@ -0,0 +1,136 @@
+package format_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+func TestDiagnosticsFromError(t *testing.T) {
+	diagErr := &format.DiagnosticsError{List: []*format.Diagnostic{
+		{Line: 2, Column: 5, Severity: format.SeverityError, Message: "unexpected token", Source: "hcl"},
+		{File: "other.hcl", Line: 3, Severity: format.SeverityWarning, Message: "deprecated", Source: "hcl"},
+	}}
+
+	diags := format.DiagnosticsFromError("main.hcl", errors.Errorf("formatting: %w", diagErr))
+	require.Len(t, diags, 2, "every diagnostic should be returned")
+	assert.Equal(t, "main.hcl", diags[0].File, "missing files should be filled in")
+	assert.Equal(t, "other.hcl", diags[1].File, "existing files should be kept")
+	assert.Empty(t, diagErr.List[0].File, "the original diagnostics should not change")
+
+	diags = format.DiagnosticsFromError("main.hcl", errors.New("permission denied"))
+	require.Len(t, diags, 1, "plain errors should become one diagnostic")
+	assert.Equal(t, &format.Diagnostic{File: "main.hcl", Severity: format.SeverityError, Message: "permission denied"}, diags[0])
+}
+
+func TestWriteDiagnostics(t *testing.T) {
+	diags := []*format.Diagnostic{
+		{File: "main.hcl", Line: 2, Column: 5, EndLine: 2, EndColumn: 6, Severity: format.SeverityError, Message: "unexpected token", Source: "hcl"},
+		{File: "main.dart", Severity: format.SeverityError, Message: "dart exited with code 65", Source: "dart"},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, format.WriteDiagnostics(&buf, format.DiagnosticsText, diags))
+		assert.Equal(t, "main.hcl:2:5: error: unexpected token\nmain.dart: error: dart exited with code 65\n", buf.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, format.WriteDiagnostics(&buf, format.DiagnosticsJSON, diags))
+
+		dec := json.NewDecoder(&buf)
+		for _, expected := range diags {
+			got := &format.Diagnostic{}
+			require.NoError(t, dec.Decode(got), "every line should be a json object")
+			assert.Equal(t, expected, got, "the diagnostic should round trip")
+		}
+	})
+
+	t.Run("sarif", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, format.WriteDiagnostics(&buf, format.DiagnosticsSARIF, diags))
+
+		log := &format.SARIFLog{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), log), "the log should be valid json")
+		require.Len(t, log.Runs, 1, "there should be one run")
+
+		results := log.Runs[0].Results
+		require.Len(t, results, 2, "every diagnostic should be a result")
+		assert.Equal(t, format.SARIFRuleParse, results[0].RuleID, "parser errors should use the parse rule")
+		assert.Equal(t, "error", results[0].Level, "level should match the severity")
+		assert.Equal(t, &format.SARIFRegion{StartLine: 2, StartColumn: 5, EndLine: 2, EndColumn: 6}, results[0].Locations[0].PhysicalLocation.Region)
+		assert.Equal(t, format.SARIFRuleExternal, results[1].RuleID, "command errors should use the external rule")
+		assert.Nil(t, results[1].Locations[0].PhysicalLocation.Region, "errors without a position should have no region")
+	})
+
+	assert.Error(t, format.WriteDiagnostics(&bytes.Buffer{}, "xml", diags), "unknown formats should be rejected")
+}
+
+func TestUnformattedToSARIF(t *testing.T) {
+	result := format.UnformattedToSARIF("main.hcl", []byte("a {\n  b = 1\n}\n"), []byte("a {\n\tb = 1\n}\n"))
+
+	assert.Equal(t, format.SARIFRuleFormat, result.RuleID, "rule should match")
+	assert.Equal(t, "warning", result.Level, "unformatted files should be warnings")
+	require.Len(t, result.Locations, 1, "there should be one location")
+	assert.Equal(t, "main.hcl", result.Locations[0].PhysicalLocation.ArtifactLocation.URI, "uri should match")
+	assert.Equal(t, &format.SARIFRegion{StartLine: 2}, result.Locations[0].PhysicalLocation.Region, "region should start at the first changed line")
+
+	require.Len(t, result.Fixes, 1, "there should be one fix")
+	require.Len(t, result.Fixes[0].ArtifactChanges, 1, "the fix should change one file")
+	replacements := result.Fixes[0].ArtifactChanges[0].Replacements
+	require.Len(t, replacements, 1, "there should be one replacement")
+	assert.Equal(t, &format.SARIFRegion{StartLine: 2, StartColumn: 1, EndLine: 2, EndColumn: 3}, replacements[0].DeletedRegion, "the indentation should be replaced")
+	assert.Equal(t, &format.SARIFArtifactContent{Text: "\t"}, replacements[0].InsertedContent, "a tab should be inserted")
+
+	result = format.UnformattedToSARIF("main.hcl", []byte("a = 1\n"), []byte("a = 1\n"))
+	assert.Nil(t, result.Locations[0].PhysicalLocation.Region, "unchanged content should have no region")
+	assert.Empty(t, result.Fixes, "unchanged content should have no fix")
+}
+
+func TestUnformattedToSARIFClampsToContent(t *testing.T) {
+	tests := []struct {
+		name      string
+		original  string
+		formatted string
+		regions   []*format.SARIFRegion
+	}{
+		{
+			name:      "final_newline_added",
+			original:  "a = 1\nb=2",
+			formatted: "a = 1\nb = 2\n",
+			regions:   []*format.SARIFRegion{{StartLine: 2, StartColumn: 2, EndLine: 2, EndColumn: 4}},
+		},
+		{
+			name:      "line_appended",
+			original:  "a\n",
+			formatted: "a\nb\n",
+			regions:   []*format.SARIFRegion{{StartLine: 1, StartColumn: 3, EndLine: 1, EndColumn: 3}},
+		},
+		{
+			name:      "last_lines_removed",
+			original:  "a\n\n\n",
+			formatted: "a\n",
+			regions:   []*format.SARIFRegion{{StartLine: 2, StartColumn: 1, EndLine: 3, EndColumn: 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := format.UnformattedToSARIF("main.hcl", []byte(tt.original), []byte(tt.formatted))
+			require.Len(t, result.Fixes, 1, "there should be one fix")
+
+			regions := []*format.SARIFRegion{}
+			for _, replacement := range result.Fixes[0].ArtifactChanges[0].Replacements {
+				regions = append(regions, replacement.DeletedRegion)
+			}
+			assert.Equal(t, tt.regions, regions, "regions should stay inside the original content")
+			assert.Equal(t, tt.regions[0].StartLine, result.Locations[0].PhysicalLocation.Region.StartLine, "the location should stay inside the original content")
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const diffContextLines = 3
+
+// UnifiedDiff returns a unified diff between the original and formatted
+// content, using "a/" and "b/" prefixed path headers so the result can be
+// passed to `git apply`. An empty string is returned when nothing changed.
+func UnifiedDiff(filename string, original, formatted []byte) string {
+	if bytes.Equal(original, formatted) {
+		return ""
+	}
+
+	a := SplitLines(original)
+	b := SplitLines(formatted)
+
+	path := diffPath(filename)
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- a/%s\n", path)
+	fmt.Fprintf(&buf, "+++ b/%s\n", path)
+
+	matcher := difflib.NewMatcherWithJunk(a, b, false, nil)
+	for _, group := range matcher.GetGroupedOpCodes(diffContextLines) {
+		first, last := group[0], group[len(group)-1]
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", unifiedRange(first.I1, last.I2), unifiedRange(first.J1, last.J2))
+
+		for _, op := range group {
+			if op.Tag == 'e' {
+				writeDiffLines(&buf, ' ', a[op.I1:op.I2])
+				continue
+			}
+			if op.Tag == 'r' || op.Tag == 'd' {
+				writeDiffLines(&buf, '-', a[op.I1:op.I2])
+			}
+			if op.Tag == 'r' || op.Tag == 'i' {
+				writeDiffLines(&buf, '+', b[op.J1:op.J2])
+			}
+		}
+	}
+
+	return buf.String()
+}
+
+// SplitLines splits the content into lines, keeping the line terminators so
+// a missing newline at the end of the content can be told apart.
+func SplitLines(content []byte) []string {
+	if len(content) == 0 {
+		return []string{}
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+func writeDiffLines(buf *strings.Builder, prefix byte, lines []string) {
+	for _, line := range lines {
+		buf.WriteByte(prefix)
+		buf.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// unifiedRange formats a zero-based, half-open line range the way the
+// unified diff hunk header expects it.
+func unifiedRange(start, stop int) string {
+	length := stop - start
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, length)
+	}
+}
+
+func diffPath(filename string) string {
+	path := filepath.ToSlash(filepath.Clean(filename))
+	path = strings.TrimPrefix(path, "./")
+	return strings.TrimLeft(path, "/")
+}
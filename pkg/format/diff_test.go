@@ -0,0 +1,80 @@
+package format_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name      string
+		filename  string
+		original  string
+		formatted string
+		expected  string
+	}{
+		{
+			name:      "no_changes",
+			filename:  "main.hcl",
+			original:  "a = 1\n",
+			formatted: "a = 1\n",
+			expected:  "",
+		},
+		{
+			name:      "single_line_change",
+			filename:  "./dir/main.hcl",
+			original:  "a=1\nb = 2\n",
+			formatted: "a = 1\nb = 2\n",
+			expected: `--- a/dir/main.hcl
++++ b/dir/main.hcl
+@@ -1,2 +1,2 @@
+-a=1
++a = 1
+ b = 2
+`,
+		},
+		{
+			name:      "missing_final_newline",
+			filename:  "/abs/main.hcl",
+			original:  "a = 1",
+			formatted: "a = 1\n",
+			expected: `--- a/abs/main.hcl
++++ b/abs/main.hcl
+@@ -1 +1 @@
+-a = 1
+\ No newline at end of file
++a = 1
+`,
+		},
+		{
+			name:      "separate_hunks",
+			filename:  "main.hcl",
+			original:  "a=1\n2\n3\n4\n5\n6\n7\n8\nb=2\n",
+			formatted: "a = 1\n2\n3\n4\n5\n6\n7\n8\nb = 2\n",
+			expected: `--- a/main.hcl
++++ b/main.hcl
+@@ -1,4 +1,4 @@
+-a=1
++a = 1
+ 2
+ 3
+ 4
+@@ -6,4 +6,4 @@
+ 6
+ 7
+ 8
+-b=2
++b = 2
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := format.UnifiedDiff(tt.filename, []byte(tt.original), []byte(tt.formatted))
+			assert.Equal(t, tt.expected, got, "diff should match expected output")
+		})
+	}
+}
@@ -5,19 +5,27 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/editorconfig/editorconfig-core-go/v2"
+	"github.com/rs/zerolog"
 	"github.com/walteh/retab/v2/pkg/format"
 	"gitlab.com/tozd/go/errors"
 )
 
 type EditorConfigConfiguration struct {
-	Definition       *editorconfig.Definition
-	parsedIndentSize int
+	Definition          *editorconfig.Definition
+	parsedIndentSize    int
+	parsedMaxLineLength int
 }
 
 type EditorConfigConfigurationProvider struct {
 	definitions *editorconfig.Editorconfig
+
+	// cache holds parsed .editorconfig files when the provider was created
+	// with NewCachedConfigurationProvider
+	cache   *editorconfig.CachedParser
+	cacheMu sync.Mutex
 }
 
 // ConfigOptions represents options for editorconfig resolution
@@ -39,6 +47,40 @@ func NewDynamicConfigurationProvider(ctx context.Context, rawContent string) (*E
 	return &EditorConfigConfigurationProvider{}, nil
 }
 
+// NewCachedConfigurationProvider resolves .editorconfig files from disk like
+// the dynamic provider, but keeps parsed files in memory until Invalidate is
+// called. This is meant for long running processes like the language server.
+func NewCachedConfigurationProvider(ctx context.Context) *EditorConfigConfigurationProvider {
+	return &EditorConfigConfigurationProvider{cache: editorconfig.NewCachedParser()}
+}
+
+// Invalidate drops all cached .editorconfig files.
+func (me *EditorConfigConfigurationProvider) Invalidate() {
+	me.cacheMu.Lock()
+	defer me.cacheMu.Unlock()
+
+	if me.cache != nil {
+		me.cache = editorconfig.NewCachedParser()
+	}
+}
+
+func (me *EditorConfigConfigurationProvider) resolveDefinition(targetFile string) (*editorconfig.Definition, error) {
+	if me.cache == nil {
+		return editorconfig.GetDefinitionForFilenameWithConfigname(targetFile, ".editorconfig")
+	}
+
+	// the cached parser is not safe for concurrent use
+	me.cacheMu.Lock()
+	defer me.cacheMu.Unlock()
+
+	config := &editorconfig.Config{
+		Name:   ".editorconfig",
+		Parser: me.cache,
+	}
+
+	return config.Load(targetFile)
+}
+
 func (me *EditorConfigConfigurationProvider) GetConfigurationForFileType(ctx context.Context, targetFile string) (format.Configuration, error) {
 	var def *editorconfig.Definition
 	var err error
@@ -50,24 +92,68 @@ func (me *EditorConfigConfigurationProvider) GetConfigurationForFileType(ctx con
 		}
 	} else {
 		// Otherwise, let the library handle auto-resolution
-		def, err = editorconfig.GetDefinitionForFilenameWithConfigname(targetFile, ".editorconfig")
+		def, err = me.resolveDefinition(targetFile)
 		if err != nil {
 			return nil, errors.Errorf("getting editorconfig definition: %w", err)
 		}
 	}
 
-	id, err := strconv.Atoi(def.IndentSize)
+	if len(def.Raw) == 0 {
+		zerolog.Ctx(ctx).Debug().Msg("no editorconfig applies, using defaults")
+		return format.DefaultConfiguration(), nil
+	}
+
+	id, err := parseIndentSize(def)
 	if err != nil {
 		return nil, errors.Errorf("parsing indent size: %w", err)
 	}
 
+	mll, err := parseMaxLineLength(def.Raw["max_line_length"])
+	if err != nil {
+		return nil, errors.Errorf("parsing max line length: %w", err)
+	}
+
 	return &EditorConfigConfiguration{
-		Definition:       def,
-		parsedIndentSize: int(id),
+		Definition:          def,
+		parsedIndentSize:    int(id),
+		parsedMaxLineLength: mll,
 	}, nil
 }
 
+// parseIndentSize falls back to tab_width when indent_size is "tab" or
+// missing, and to the default size when neither is set.
+func parseIndentSize(def *editorconfig.Definition) (int, error) {
+	switch strings.ToLower(def.IndentSize) {
+	case "", editorconfig.UnsetValue, "tab":
+		if def.TabWidth > 0 {
+			return def.TabWidth, nil
+		}
+		return format.DefaultIndentSize, nil
+	}
+
+	return strconv.Atoi(def.IndentSize)
+}
+
+// parseMaxLineLength returns 0 when the value is missing or "off".
+func parseMaxLineLength(value string) (int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" || value == "off" {
+		return 0, nil
+	}
+
+	mll, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if mll < 0 {
+		return 0, errors.Errorf("negative max line length: %d", mll)
+	}
+
+	return mll, nil
+}
+
 var _ format.Configuration = &EditorConfigConfiguration{}
+var _ format.ExternalFormatterConfiguration = &EditorConfigConfiguration{}
 
 func (x *EditorConfigConfiguration) IndentSize() int {
 	return x.parsedIndentSize
@@ -84,3 +170,55 @@ func (x *EditorConfigConfiguration) TrimMultipleEmptyLines() bool {
 func (x *EditorConfigConfiguration) OneBracketPerLine() bool {
 	return x.Definition.Raw["one_bracket_per_line"] == "true"
 }
+
+func (x *EditorConfigConfiguration) MaxLineLength() int {
+	return x.parsedMaxLineLength
+}
+
+func (x *EditorConfigConfiguration) EndOfLine() string {
+	if x.Definition.EndOfLine == editorconfig.UnsetValue {
+		return ""
+	}
+	return x.Definition.EndOfLine
+}
+
+func (x *EditorConfigConfiguration) InsertFinalNewline() *bool {
+	return x.Definition.InsertFinalNewline
+}
+
+func (x *EditorConfigConfiguration) TrimTrailingWhitespace() bool {
+	return x.Definition.TrimTrailingWhitespace != nil && *x.Definition.TrimTrailingWhitespace
+}
+
+func (x *EditorConfigConfiguration) Charset() string {
+	if x.Definition.Charset == editorconfig.UnsetValue {
+		return ""
+	}
+	return x.Definition.Charset
+}
+
+func (x *EditorConfigConfiguration) ExternalCommand() string {
+	return rawString(x.Definition.Raw["retab_external_command"])
+}
+
+// ExternalIndent accepts "\t" for tabs, since whitespace only survives in
+// editorconfig values when quoted.
+func (x *EditorConfigConfiguration) ExternalIndent() string {
+	return strings.ReplaceAll(rawString(x.Definition.Raw["retab_external_indent"]), `\t`, "\t")
+}
+
+func (x *EditorConfigConfiguration) ExternalTimeout() string {
+	return rawString(x.Definition.Raw["retab_external_timeout"])
+}
+
+func (x *EditorConfigConfiguration) ExternalInPlace() bool {
+	return strings.EqualFold(x.Definition.Raw["retab_external_in_place"], "true")
+}
+
+// rawString returns a custom value with "unset" treated as empty.
+func rawString(value string) string {
+	if value == editorconfig.UnsetValue {
+		return ""
+	}
+	return value
+}
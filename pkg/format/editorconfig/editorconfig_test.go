@@ -0,0 +1,145 @@
+package editorconfig_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/format/editorconfig"
+)
+
+func TestGetConfigurationForFileType(t *testing.T) {
+	tests := []struct {
+		name                   string
+		content                string
+		useTabs                bool
+		indentSize             int
+		trimMultipleEmptyLines bool
+		oneBracketPerLine      bool
+	}{
+		{
+			name:                   "no_matching_section_uses_defaults",
+			content:                "root = true\n[*.go]\nindent_style = space\nindent_size = 2\n",
+			useTabs:                true,
+			indentSize:             4,
+			trimMultipleEmptyLines: true,
+			oneBracketPerLine:      true,
+		},
+		{
+			name:       "indent_size_tab_uses_tab_width",
+			content:    "root = true\n[*]\nindent_style = tab\nindent_size = tab\ntab_width = 8\n",
+			useTabs:    true,
+			indentSize: 8,
+		},
+		{
+			name:       "indent_size_tab_without_tab_width",
+			content:    "root = true\n[*]\nindent_style = tab\nindent_size = tab\n",
+			useTabs:    true,
+			indentSize: 4,
+		},
+		{
+			name:       "missing_indent_size_uses_tab_width",
+			content:    "root = true\n[*]\nindent_style = space\ntab_width = 2\n",
+			useTabs:    false,
+			indentSize: 2,
+		},
+		{
+			name:       "missing_indent_settings",
+			content:    "root = true\n[*]\ntrim_trailing_whitespace = true\n",
+			useTabs:    true,
+			indentSize: 4,
+		},
+		{
+			name:       "only_max_line_length_keeps_indent_defaults",
+			content:    "root = true\n[*]\nmax_line_length = 80\n",
+			useTabs:    true,
+			indentSize: 4,
+		},
+		{
+			name:       "indent_settings_leave_custom_settings_off",
+			content:    "root = true\n[*]\nindent_style = tab\nindent_size = 4\n",
+			useTabs:    true,
+			indentSize: 4,
+		},
+		{
+			name:       "unset_custom_settings_are_off",
+			content:    "root = true\n[*]\ntrim_multiple_empty_lines = unset\none_bracket_per_line = unset\n",
+			useTabs:    true,
+			indentSize: 4,
+		},
+		{
+			name:                   "explicit_settings",
+			content:                "root = true\n[*]\nindent_style = space\nindent_size = 2\ntrim_multiple_empty_lines = true\none_bracket_per_line = false\n",
+			useTabs:                false,
+			indentSize:             2,
+			trimMultipleEmptyLines: true,
+			oneBracketPerLine:      false,
+		},
+		{
+			name:                   "explicit_false",
+			content:                "root = true\n[*]\ntrim_multiple_empty_lines = false\none_bracket_per_line = false\n",
+			useTabs:                true,
+			indentSize:             4,
+			trimMultipleEmptyLines: false,
+			oneBracketPerLine:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := editorconfig.NewDynamicConfigurationProvider(context.Background(), tt.content)
+			require.NoError(t, err, "parsing editorconfig should succeed")
+
+			cfg, err := provider.GetConfigurationForFileType(context.Background(), "dir/main.hcl")
+			require.NoError(t, err, "getting configuration should succeed")
+
+			assert.Equal(t, tt.useTabs, cfg.UseTabs(), "use tabs should match")
+			assert.Equal(t, tt.indentSize, cfg.IndentSize(), "indent size should match")
+			assert.Equal(t, tt.trimMultipleEmptyLines, cfg.TrimMultipleEmptyLines(), "trim multiple empty lines should match")
+			assert.Equal(t, tt.oneBracketPerLine, cfg.OneBracketPerLine(), "one bracket per line should match")
+		})
+	}
+}
+
+func TestGetConfigurationForFileTypeInvalidIndentSize(t *testing.T) {
+	provider, err := editorconfig.NewDynamicConfigurationProvider(context.Background(), "root = true\n[*]\nindent_size = wide\n")
+	require.NoError(t, err, "parsing editorconfig should succeed")
+
+	_, err = provider.GetConfigurationForFileType(context.Background(), "main.hcl")
+	assert.Error(t, err, "an invalid indent size should be reported")
+}
+
+func TestExternalFormatterKeys(t *testing.T) {
+	provider, err := editorconfig.NewDynamicConfigurationProvider(context.Background(), `root = true
+[*.go]
+retab_external_command = gofmt -s
+retab_external_indent = "\t"
+[*.sh]
+retab_external_command = shfmt -i 2 -
+retab_external_indent = "  "
+`)
+	require.NoError(t, err, "parsing editorconfig should succeed")
+
+	tests := []struct {
+		filename string
+		command  string
+		indent   string
+	}{
+		{filename: "main.go", command: "gofmt -s", indent: "\t"},
+		{filename: "run.sh", command: "shfmt -i 2 -", indent: "  "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			cfg, err := provider.GetConfigurationForFileType(context.Background(), tt.filename)
+			require.NoError(t, err, "getting configuration should succeed")
+
+			ext, ok := cfg.(format.ExternalFormatterConfiguration)
+			require.True(t, ok, "configuration should declare external formatters")
+			assert.Equal(t, tt.command, ext.ExternalCommand(), "command should match")
+			assert.Equal(t, tt.indent, ext.ExternalIndent(), "indent should match")
+		})
+	}
+}
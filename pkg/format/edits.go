@@ -0,0 +1,116 @@
+package format
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// jsonTextEdit is the flat representation of a TextEdit used by the cli and
+// the wasm bridge.
+type jsonTextEdit struct {
+	StartLine int    `json:"startLine"`
+	StartCol  int    `json:"startCol"`
+	EndLine   int    `json:"endLine"`
+	EndCol    int    `json:"endCol"`
+	NewText   string `json:"newText"`
+}
+
+func (me *TextEdit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&jsonTextEdit{
+		StartLine: me.Start.Line,
+		StartCol:  me.Start.Column,
+		EndLine:   me.End.Line,
+		EndCol:    me.End.Column,
+		NewText:   me.NewText,
+	})
+}
+
+func (me *TextEdit) UnmarshalJSON(data []byte) error {
+	var edit jsonTextEdit
+	if err := json.Unmarshal(data, &edit); err != nil {
+		return err
+	}
+
+	me.Start = Position{Line: edit.StartLine, Column: edit.StartCol}
+	me.End = Position{Line: edit.EndLine, Column: edit.EndCol}
+	me.NewText = edit.NewText
+
+	return nil
+}
+
+// ComputeEdits returns the minimal edits that turn original into formatted.
+// Changed blocks of lines are found first, then the text both sides have in
+// common at the start and end of each block is left out of the edit, so
+// editors keep the cursor, folding and undo history around the change.
+func ComputeEdits(original, formatted []byte) []*TextEdit {
+	a := SplitLines(original)
+	b := SplitLines(formatted)
+
+	edits := []*TextEdit{}
+	matcher := difflib.NewMatcherWithJunk(a, b, false, nil)
+	for _, op := range matcher.GetOpCodes() {
+		if op.Tag == 'e' {
+			continue
+		}
+
+		before := strings.Join(a[op.I1:op.I2], "")
+		after := strings.Join(b[op.J1:op.J2], "")
+
+		prefix := commonPrefixLen(before, after)
+		suffix := commonSuffixLen(before[prefix:], after[prefix:])
+
+		start := advance(Position{Line: op.I1}, before[:prefix])
+		end := advance(start, before[prefix:len(before)-suffix])
+
+		edits = append(edits, &TextEdit{
+			Start:   start,
+			End:     end,
+			NewText: after[prefix : len(after)-suffix],
+		})
+	}
+
+	return edits
+}
+
+// commonPrefixLen returns the length in bytes of the longest common prefix,
+// never splitting a rune.
+func commonPrefixLen(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	for n > 0 && n < len(a) && !utf8.RuneStart(a[n]) {
+		n--
+	}
+	return n
+}
+
+// commonSuffixLen returns the length in bytes of the longest common suffix,
+// never splitting a rune.
+func commonSuffixLen(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	for n > 0 && !utf8.RuneStart(a[len(a)-n]) {
+		n--
+	}
+	return n
+}
+
+// advance moves the position past the text.
+func advance(pos Position, text string) Position {
+	for _, r := range text {
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 0
+			continue
+		}
+		pos.Column += len(utf16.Encode([]rune{r}))
+	}
+	return pos
+}
@@ -0,0 +1,89 @@
+package format_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+func TestComputeEdits(t *testing.T) {
+	tests := []struct {
+		name      string
+		original  string
+		formatted string
+		expected  []*format.TextEdit
+	}{
+		{
+			name:      "no_changes",
+			original:  "a = 1\n",
+			formatted: "a = 1\n",
+			expected:  []*format.TextEdit{},
+		},
+		{
+			name:      "change_inside_line",
+			original:  "a=1\nb = 2\n",
+			formatted: "a = 1\nb = 2\n",
+			expected: []*format.TextEdit{
+				{Start: format.Position{Line: 0, Column: 1}, End: format.Position{Line: 0, Column: 2}, NewText: " = "},
+			},
+		},
+		{
+			name:      "replace_indentation",
+			original:  "x {\n  a = 1\n}\n",
+			formatted: "x {\n\ta = 1\n}\n",
+			expected: []*format.TextEdit{
+				{Start: format.Position{Line: 1, Column: 0}, End: format.Position{Line: 1, Column: 2}, NewText: "\t"},
+			},
+		},
+		{
+			name:      "add_final_newline",
+			original:  "a = 1",
+			formatted: "a = 1\n",
+			expected: []*format.TextEdit{
+				{Start: format.Position{Line: 0, Column: 5}, End: format.Position{Line: 0, Column: 5}, NewText: "\n"},
+			},
+		},
+		{
+			name:      "delete_lines",
+			original:  "a = 1\n\n\n\nb = 2\n",
+			formatted: "a = 1\n\nb = 2\n",
+			expected: []*format.TextEdit{
+				{Start: format.Position{Line: 2, Column: 0}, End: format.Position{Line: 4, Column: 0}, NewText: ""},
+			},
+		},
+		{
+			name:      "utf16_columns",
+			original:  "s = \"😀\"  # x\n",
+			formatted: "s = \"😀\" # x\n",
+			expected: []*format.TextEdit{
+				{Start: format.Position{Line: 0, Column: 9}, End: format.Position{Line: 0, Column: 10}, NewText: ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits := format.ComputeEdits([]byte(tt.original), []byte(tt.formatted))
+			assert.Equal(t, tt.expected, edits, "edits should be minimal")
+
+			result, err := format.ApplyEdits([]byte(tt.original), edits)
+			require.NoError(t, err, "applying edits should succeed")
+			assert.Equal(t, tt.formatted, string(result), "applying edits should produce the formatted content")
+		})
+	}
+}
+
+func TestTextEditJSON(t *testing.T) {
+	edit := &format.TextEdit{Start: format.Position{Line: 1, Column: 2}, End: format.Position{Line: 3, Column: 4}, NewText: "x"}
+
+	data, err := json.Marshal(edit)
+	require.NoError(t, err, "encoding edit should succeed")
+	assert.JSONEq(t, `{"startLine":1,"startCol":2,"endLine":3,"endCol":4,"newText":"x"}`, string(data), "edit should be encoded flat")
+
+	decoded := &format.TextEdit{}
+	require.NoError(t, json.Unmarshal(data, decoded), "decoding edit should succeed")
+	assert.Equal(t, edit, decoded, "edit should survive a round trip")
+}
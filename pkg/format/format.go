@@ -1,12 +1,11 @@
 package format
 
 import (
+	"bytes"
 	"context"
 	"io"
-	"path/filepath"
 	"reflect"
 
-	"github.com/bmatcuk/doublestar/v4"
 	"github.com/rs/zerolog"
 	"gitlab.com/tozd/go/errors"
 )
@@ -16,34 +15,67 @@ type Provider interface {
 	Targets() []string
 }
 
+type filenameKey struct{}
+
+// WithFilename records the path of the file being formatted, for providers
+// that need more than its content.
+func WithFilename(ctx context.Context, filename string) context.Context {
+	return context.WithValue(ctx, filenameKey{}, filename)
+}
+
+// Filename returns the path of the file being formatted, as set by Format
+// and FormatRange, or an empty string when it is unknown.
+func Filename(ctx context.Context) string {
+	filename, _ := ctx.Value(filenameKey{}).(string)
+	return filename
+}
+
 func Format(ctx context.Context, provider Provider, cfg ConfigurationProvider, filename string, fle io.Reader) (io.Reader, error) {
 	ctx = zerolog.Ctx(ctx).With().Str("path", filename).Str("provider", reflect.TypeOf(provider).Elem().String()).Logger().WithContext(ctx)
+	ctx = WithFilename(ctx, filename)
 
 	efg, err := cfg.GetConfigurationForFileType(ctx, filename)
 	if err != nil {
 		return nil, errors.Errorf("failed to get editorconfig: %w", err)
 	}
 
-	r, err := provider.Format(ctx, efg, fle)
+	input, err := io.ReadAll(fle)
+	if err != nil {
+		return nil, errors.Errorf("failed to read content: %w", err)
+	}
+
+	input, err = decodeInput(efg, input)
+	if err != nil {
+		return nil, errors.Errorf("failed to decode content: %w", err)
+	}
+
+	r, err := provider.Format(ctx, efg, bytes.NewReader(input))
+	if err != nil {
+		return nil, errors.Errorf("failed to format: %w", withFilename(err, filename))
+	}
+
+	output, err := io.ReadAll(r)
 	if err != nil {
-		return nil, errors.Errorf("failed to format: %w", err)
+		return nil, errors.Errorf("failed to read formatted content: %w", err)
 	}
 
-	return r, nil
+	output, err = encodeOutput(efg, output)
+	if err != nil {
+		return nil, errors.Errorf("failed to encode content: %w", err)
+	}
+
+	return bytes.NewReader(output), nil
 }
 
 // AutoDetectFormatter attempts to find a suitable formatter based on the filename
 func AutoDetectFormatter(filename string, formatters []Provider) (Provider, error) {
-	basename := filepath.Base(filename)
 	for _, fmtr := range formatters {
-		for _, target := range fmtr.Targets() {
-			ok, err := doublestar.Match(target, basename)
-			if err != nil {
-				return nil, errors.Errorf("failed to match glob: %w", err)
-			}
-			if ok {
-				return fmtr, nil
-			}
+		ok, err := matchTargets(fmtr.Targets(), filename)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return fmtr, nil
 		}
 	}
 
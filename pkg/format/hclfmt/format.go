@@ -3,7 +3,6 @@ package hclfmt
 import (
 	"context"
 	"io"
-	"os"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
@@ -89,8 +88,7 @@ func (ts Tokens) WriteTo(wr io.Writer, cfg format.Configuration) (int64, error)
 }
 
 func FormatBytes(cfg format.Configuration, src []byte) (io.Reader, error) {
-	tokens := lexConfig(src, cfg)
-	tokens.format()
+	tokens := formatTokens(src, cfg)
 	r, w := io.Pipe()
 	go func() {
 		_, err := tokens.WriteTo(w, cfg)
@@ -133,19 +131,40 @@ func FormatBytes(cfg format.Configuration, src []byte) (io.Reader, error) {
 // 	return afero.WriteReader(fs, fle, newContents)
 // }
 
-// checkErrors takes in the contents of a hcl file and looks for syntaxterrors.
+// checkErrors parses the contents of a hcl file and returns its syntax
+// errors as a *format.DiagnosticsError. Warnings alone are only logged.
 func checkErrors(ctx context.Context, contents []byte, fle string) error {
 	parser := hclparse.NewParser()
 	_, diags := parser.ParseHCL(contents, fle)
-	diagWriter := hcl.NewDiagnosticTextWriter(os.Stdout, parser.Files(), 0, true)
-	defer func() {
-		err := diagWriter.WriteDiagnostics(diags)
-		if err != nil {
-			zerolog.Ctx(ctx).Error().Err(err).Msgf("Error writing diagnostics for %s", fle)
+	if !diags.HasErrors() {
+		for _, diag := range diags {
+			zerolog.Ctx(ctx).Warn().Str("diagnostic", diag.Error()).Msg("hcl parse warning")
 		}
-	}()
-	if diags.HasErrors() {
-		return diags
+		return nil
+	}
+
+	return &format.DiagnosticsError{List: convertDiagnostics(diags), Err: diags}
+}
+
+func convertDiagnostics(diags hcl.Diagnostics) []*format.Diagnostic {
+	converted := []*format.Diagnostic{}
+	for _, diag := range diags {
+		severity := format.SeverityError
+		if diag.Severity == hcl.DiagWarning {
+			severity = format.SeverityWarning
+		}
+
+		message := diag.Summary
+		if diag.Detail != "" {
+			message += ": " + diag.Detail
+		}
+
+		d := &format.Diagnostic{Severity: severity, Message: message, Source: "hcl"}
+		if diag.Subject != nil {
+			d.Line, d.Column = diag.Subject.Start.Line, diag.Subject.Start.Column
+			d.EndLine, d.EndColumn = diag.Subject.End.Line, diag.Subject.End.Column
+		}
+		converted = append(converted, d)
 	}
-	return nil
+	return converted
 }
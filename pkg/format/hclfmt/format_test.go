@@ -2,10 +2,14 @@ package hclfmt_test
 
 import (
 	"bytes"
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/walteh/retab/v2/gen/mockery"
+	"github.com/walteh/retab/v2/pkg/format"
 	"github.com/walteh/retab/v2/pkg/format/hclfmt"
 )
 
@@ -16,6 +20,7 @@ func TestFormat(t *testing.T) {
 		indentSize             int
 		trimMultipleEmptyLines bool
 		oneBracketPerLine      bool
+		maxLineLength          int
 		src                    []byte
 		expected               []byte
 	}{
@@ -119,6 +124,126 @@ variable "DESTDIR1" {
 	required = true
 }`),
 		},
+		{
+			name:          "max line length - function arguments",
+			useTabs:       true,
+			indentSize:    4,
+			maxLineLength: 50,
+			src: []byte(`locals {
+  joined = join(",", concat(var.first_list, var.second_list))
+  short = max(1, 2)
+}
+`),
+			expected: []byte(`locals {
+	joined = join(
+		",",
+		concat(var.first_list, var.second_list),
+	)
+	short = max(1, 2)
+}
+`),
+		},
+		{
+			name:          "max line length - nested tuple",
+			useTabs:       false,
+			indentSize:    2,
+			maxLineLength: 30,
+			src: []byte(`a = ["alpha", "beta", ["gamma", "delta", "epsilon", "zeta"]]
+`),
+			expected: []byte(`a = [
+  "alpha",
+  "beta",
+  [
+    "gamma",
+    "delta",
+    "epsilon",
+    "zeta",
+  ],
+]
+`),
+		},
+		{
+			name:          "max line length - object",
+			useTabs:       true,
+			indentSize:    4,
+			maxLineLength: 30,
+			src: []byte(`tags = { Name = "example", Environment = "production" }
+`),
+			expected: []byte(`tags = {
+	Name        = "example"
+	Environment = "production"
+}
+`),
+		},
+		{
+			name:          "max line length - no comma after ellipsis",
+			useTabs:       true,
+			indentSize:    4,
+			maxLineLength: 30,
+			src: []byte(`x = merge(var.defaults, var.overrides...)
+`),
+			expected: []byte(`x = merge(
+	var.defaults,
+	var.overrides...
+)
+`),
+		},
+		{
+			name:          "max line length - for expressions and templates are kept",
+			useTabs:       true,
+			indentSize:    4,
+			maxLineLength: 20,
+			src: []byte(`x = [for v in var.values : upper(v)]
+y = "${join(", ", var.values)}"
+`),
+			expected: []byte(`x = [for v in var.values : upper(v)]
+y = "${join(", ", var.values)}"
+`),
+		},
+		{
+			name:          "max line length - short pair before the long part is kept",
+			useTabs:       true,
+			indentSize:    4,
+			maxLineLength: 40,
+			src: []byte(`d = foo(bar)[0] + "a very long string that does not fit anywhere"
+`),
+			expected: []byte(`d = foo(bar)[0] + "a very long string that does not fit anywhere"
+`),
+		},
+		{
+			name:          "max line length - longest pair is broken",
+			useTabs:       true,
+			indentSize:    4,
+			maxLineLength: 50,
+			src: []byte(`d = foo(bar)[0] + join(",", var.alpha, var.beta, var.gamma)
+`),
+			expected: []byte(`d = foo(bar)[0] + join(
+	",",
+	var.alpha,
+	var.beta,
+	var.gamma,
+)
+`),
+		},
+		{
+			name:          "max line length - tabs count as indent size",
+			useTabs:       true,
+			indentSize:    8,
+			maxLineLength: 24,
+			src: []byte(`a {
+	b = f(1, 2, 3, 4)
+}
+`),
+			expected: []byte(`a {
+	b = f(
+		1,
+		2,
+		3,
+		4,
+	)
+}
+`),
+		},
 	}
 
 	for _, tt := range tests {
@@ -128,6 +253,7 @@ variable "DESTDIR1" {
 			cfg.EXPECT().IndentSize().Return(tt.indentSize)
 			cfg.EXPECT().TrimMultipleEmptyLines().Return(tt.trimMultipleEmptyLines)
 			cfg.EXPECT().OneBracketPerLine().Return(tt.oneBracketPerLine)
+			cfg.EXPECT().MaxLineLength().Return(tt.maxLineLength)
 
 			// Call the Format function with the provided configuration and source
 			result, err := hclfmt.FormatBytes(cfg, tt.src)
@@ -149,3 +275,30 @@ variable "DESTDIR1" {
 		})
 	}
 }
+
+func TestSniff(t *testing.T) {
+	fmtr := hclfmt.NewFormatter()
+
+	assert.True(t, fmtr.Sniff([]byte("job \"web\" {\n\tgroup \"app\" {}\n}\n")), "hcl blocks should be recognized")
+	assert.True(t, fmtr.Sniff([]byte("a = 1\n")), "hcl attributes should be recognized")
+	assert.False(t, fmtr.Sniff([]byte("syntax = \"proto3\";\n")), "protobuf should not be recognized")
+	assert.False(t, fmtr.Sniff([]byte("")), "empty content should not be recognized")
+}
+
+func TestParseErrorDiagnostics(t *testing.T) {
+	cfg := mockery.NewMockConfiguration_format(t)
+
+	_, err := hclfmt.NewFormatter().Format(context.Background(), cfg, strings.NewReader("a = {\nb = \n"))
+	require.Error(t, err, "invalid hcl should fail")
+
+	var diagErr *format.DiagnosticsError
+	require.ErrorAs(t, err, &diagErr, "the error should carry diagnostics")
+	require.NotEmpty(t, diagErr.Diagnostics(), "there should be at least one diagnostic")
+
+	diag := diagErr.Diagnostics()[0]
+	assert.Equal(t, format.SeverityError, diag.Severity, "severity should match")
+	assert.Equal(t, 2, diag.Line, "line should match")
+	assert.Equal(t, 5, diag.Column, "column should match")
+	assert.Equal(t, "hcl", diag.Source, "source should match")
+	assert.Contains(t, diag.Message, "Invalid expression", "message should match")
+}
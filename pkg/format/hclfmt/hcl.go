@@ -4,6 +4,9 @@ import (
 	"context"
 	"io"
 
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+
 	"github.com/walteh/retab/v2/pkg/format"
 )
 
@@ -11,13 +14,30 @@ type Formatter struct {
 }
 
 var _ format.Provider = (*Formatter)(nil)
+var _ format.Sniffer = (*Formatter)(nil)
+
+func init() {
+	format.MustRegister(&format.Registration{Name: "hcl", Aliases: []string{"hcl2", "nomad", "packer"}, Provider: NewFormatter(), Capabilities: format.CapabilityDiagnostics})
+}
 
 func NewFormatter() *Formatter {
 	return &Formatter{}
 }
 
 func (me *Formatter) Targets() []string {
-	return []string{"*.hcl", "*.hcl2", ".retab/*.retab"}
+	return []string{"*.hcl", "*.hcl2", "*.nomad", ".retab/*.retab"}
+}
+
+// Sniff accepts content that parses as hcl without errors and has at least
+// one attribute or block.
+func (me *Formatter) Sniff(head []byte) bool {
+	file, diags := hclsyntax.ParseConfig(head, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return false
+	}
+
+	body, ok := file.Body.(*hclsyntax.Body)
+	return ok && (len(body.Attributes) > 0 || len(body.Blocks) > 0)
 }
 
 func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
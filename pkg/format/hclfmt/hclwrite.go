@@ -15,6 +15,9 @@ const NumSpacesPerIndent = 1
 type Token struct {
 	hclwrite.Token
 	TabsBefore int
+	// SourceRange is where the token came from in the original source.
+	// Injected newlines carry the range of the token that follows them.
+	SourceRange hcl.Range
 }
 type Tokens []*Token
 
@@ -36,8 +36,6 @@ func writerTokens(nativeTokens hclsyntax.Tokens, cfg format.Configuration) Token
 					Bytes: []byte("\n"),
 					Range: nt.Range,
 				})
-				nt.Range.Start.Line++
-				nt.Range.End.Line++
 
 				myline = []hclsyntax.Token{}
 			}
@@ -80,7 +78,8 @@ func writerTokens(nativeTokens hclsyntax.Tokens, cfg format.Configuration) Token
 				// of bytes skipped is also the number of space characters.
 				SpacesBefore: mainToken.Range.Start.Byte - lastByteOffset,
 			},
-			TabsBefore: 0,
+			TabsBefore:  0,
+			SourceRange: mainToken.Range,
 		}
 
 		lastByteOffset = mainToken.Range.End.Byte
@@ -0,0 +1,102 @@
+package hclfmt
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+var _ format.RangeProvider = (*Formatter)(nil)
+
+// FormatRange formats the whole token stream, so indentation and alignment
+// take the surrounding lines into account, but only rewrites the lines in the
+// range. The range is widened to cover tokens that span multiple lines, such
+// as heredocs and block comments.
+func (me *Formatter) FormatRange(ctx context.Context, cfg format.Configuration, src []byte, rng format.LineRange) ([]*format.TextEdit, error) {
+	err := checkErrors(ctx, src, "")
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := formatTokens(src, cfg)
+
+	// the lines each token spans, one-based like hcl positions
+	starts, ends := make([]int, len(tokens)), make([]int, len(tokens))
+	for i, token := range tokens {
+		starts[i], ends[i] = token.SourceRange.Start.Line, token.SourceRange.End.Line
+		if ends[i] > starts[i] && token.SourceRange.End.Column == 1 {
+			// tokens ending in a newline end at the start of the next line
+			ends[i]--
+		}
+	}
+
+	// a heredoc is one unit from its opening to its closing marker
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].Type != hclsyntax.TokenOHeredoc {
+			continue
+		}
+		j := i
+		for j < len(tokens)-1 && tokens[j].Type != hclsyntax.TokenCHeredoc {
+			j++
+		}
+		for k := i; k <= j; k++ {
+			starts[k], ends[k] = starts[i], ends[j]
+		}
+		i = j
+	}
+
+	lo, hi := rng.Start+1, rng.End+1
+	for changed := true; changed; {
+		changed = false
+		for i, token := range tokens {
+			if token.Type == hclsyntax.TokenEOF || ends[i] < lo || starts[i] > hi {
+				continue
+			}
+			if starts[i] < lo {
+				lo, changed = starts[i], true
+			}
+			if ends[i] > hi {
+				hi, changed = ends[i], true
+			}
+		}
+	}
+
+	selected := Tokens{}
+	for i, token := range tokens {
+		if token.Type == hclsyntax.TokenEOF {
+			continue
+		}
+		if starts[i] >= lo && starts[i] <= hi {
+			selected = append(selected, token)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := selected.WriteTo(&buf, cfg); err != nil {
+		return nil, err
+	}
+
+	lines := format.SplitLines(src)
+	if lo-1 >= len(lines) {
+		return []*format.TextEdit{}, nil
+	}
+	if hi > len(lines) {
+		hi = len(lines)
+	}
+
+	original := strings.Join(lines[lo-1:hi], "")
+	if original == buf.String() {
+		return []*format.TextEdit{}, nil
+	}
+
+	return []*format.TextEdit{
+		{
+			Start:   format.Position{Line: lo - 1},
+			End:     format.LineStart(lines, hi),
+			NewText: buf.String(),
+		},
+	}, nil
+}
@@ -0,0 +1,113 @@
+package hclfmt_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mockery"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/format/hclfmt"
+)
+
+func TestFormatRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		rng      format.LineRange
+		expected string
+	}{
+		{
+			name:     "only_selected_line",
+			src:      "a=1\n\nb=2\n\nc=3\n",
+			rng:      format.LineRange{Start: 2, End: 2},
+			expected: "a=1\n\nb = 2\n\nc=3\n",
+		},
+		{
+			name: "indentation_uses_surrounding_blocks",
+			src: `block "x" {
+  a=1
+  b = 2
+}
+`,
+			rng: format.LineRange{Start: 1, End: 1},
+			expected: `block "x" {
+	a = 1
+  b = 2
+}
+`,
+		},
+		{
+			name: "range_widens_to_cover_heredoc",
+			src: `a=1
+b=<<EOT
+  keep   this
+EOT
+c=3
+`,
+			rng: format.LineRange{Start: 2, End: 2},
+			expected: `a=1
+b = <<EOT
+  keep   this
+EOT
+c=3
+`,
+		},
+		{
+			name:     "no_changes",
+			src:      "a = 1\n",
+			rng:      format.LineRange{Start: 0, End: 0},
+			expected: "a = 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mockery.NewMockConfiguration_format(t)
+			cfg.EXPECT().UseTabs().Return(true).Maybe()
+			cfg.EXPECT().IndentSize().Return(4).Maybe()
+			cfg.EXPECT().TrimMultipleEmptyLines().Return(false).Maybe()
+			cfg.EXPECT().OneBracketPerLine().Return(false).Maybe()
+			cfg.EXPECT().MaxLineLength().Return(0).Maybe()
+
+			edits, err := hclfmt.NewFormatter().FormatRange(context.Background(), cfg, []byte(tt.src), tt.rng)
+			require.NoError(t, err, "formatting range should succeed")
+
+			result, err := format.ApplyEdits([]byte(tt.src), edits)
+			require.NoError(t, err, "applying edits should succeed")
+
+			assert.Equal(t, tt.expected, string(result), "only the range should be formatted")
+		})
+	}
+}
+
+func TestFormatRangeMatchesFormat(t *testing.T) {
+	src := []byte(`variable "DESTDIR" {
+  default = "./bin"
+  required = true
+  ok = [{abc = 1}]
+}
+`)
+
+	cfg := mockery.NewMockConfiguration_format(t)
+	cfg.EXPECT().UseTabs().Return(true).Maybe()
+	cfg.EXPECT().IndentSize().Return(4).Maybe()
+	cfg.EXPECT().TrimMultipleEmptyLines().Return(false).Maybe()
+	cfg.EXPECT().OneBracketPerLine().Return(true).Maybe()
+	cfg.EXPECT().MaxLineLength().Return(0).Maybe()
+
+	r, err := hclfmt.FormatBytes(cfg, src)
+	require.NoError(t, err, "formatting should succeed")
+	expected, err := io.ReadAll(r)
+	require.NoError(t, err, "reading formatted content should succeed")
+
+	edits, err := hclfmt.NewFormatter().FormatRange(context.Background(), cfg, src, format.LineRange{Start: 0, End: 4})
+	require.NoError(t, err, "formatting range should succeed")
+
+	result, err := format.ApplyEdits(src, edits)
+	require.NoError(t, err, "applying edits should succeed")
+
+	assert.Equal(t, string(expected), string(result), "formatting every line should match formatting the file")
+}
@@ -0,0 +1,187 @@
+package hclfmt
+
+import (
+	"context"
+	"io"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+// TerraformFormatter formats terraform configuration the way `terraform fmt`
+// does, without needing the terraform binary: on top of the regular hcl
+// formatting it unwraps interpolation-only expressions, replaces legacy
+// quoted type keywords in variable blocks and quotes block labels.
+type TerraformFormatter struct {
+}
+
+var _ format.Provider = (*TerraformFormatter)(nil)
+
+func init() {
+	format.MustRegister(&format.Registration{Name: "tf", Aliases: []string{"terraform"}, Provider: NewTerraformFormatter(), Capabilities: format.CapabilityDiagnostics})
+}
+
+func NewTerraformFormatter() *TerraformFormatter {
+	return &TerraformFormatter{}
+}
+
+func (me *TerraformFormatter) Targets() []string {
+	return []string{"*.tf", "*.tfvars"}
+}
+
+func (me *TerraformFormatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
+	reads, err := io.ReadAll(read)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkErrors(ctx, reads, "")
+	if err != nil {
+		return nil, err
+	}
+
+	file, diags := hclwrite.ParseConfig(reads, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	formatTerraformBody(file.Body(), nil)
+
+	return FormatBytes(cfg, file.Bytes())
+}
+
+// formatTerraformBody mirrors the body rewrites of `terraform fmt`.
+func formatTerraformBody(body *hclwrite.Body, inBlocks []string) {
+	for name, attr := range body.Attributes() {
+		if len(inBlocks) == 1 && inBlocks[0] == "variable" && name == "type" {
+			body.SetAttributeRaw(name, formatTerraformTypeExpr(attr.Expr().BuildTokens(nil)))
+			continue
+		}
+		body.SetAttributeRaw(name, formatTerraformValueExpr(attr.Expr().BuildTokens(nil)))
+	}
+
+	for _, block := range body.Blocks() {
+		// drops anything odd between the labels, like inline comments, and
+		// quotes bare labels
+		block.SetLabels(block.Labels())
+
+		nested := append(append([]string{}, inBlocks...), block.Type())
+		formatTerraformBody(block.Body(), nested)
+	}
+}
+
+// formatTerraformValueExpr unwraps "${ ... }" when the interpolation is the
+// whole template. Multi-line expressions are wrapped in parentheses so they
+// still parse once unwrapped.
+func formatTerraformValueExpr(tokens hclwrite.Tokens) hclwrite.Tokens {
+	if len(tokens) < 5 {
+		// too short to be a "${ ... }" sequence
+		return tokens
+	}
+
+	oQuote, oBrace := tokens[0], tokens[1]
+	cBrace, cQuote := tokens[len(tokens)-2], tokens[len(tokens)-1]
+	if oQuote.Type != hclsyntax.TokenOQuote || oBrace.Type != hclsyntax.TokenTemplateInterp || cBrace.Type != hclsyntax.TokenTemplateSeqEnd || cQuote.Type != hclsyntax.TokenCQuote {
+		return tokens
+	}
+
+	inside := tokens[2 : len(tokens)-2]
+
+	quotes := 0
+	for _, token := range inside {
+		switch {
+		case token.Type == hclsyntax.TokenOQuote:
+			quotes++
+		case token.Type == hclsyntax.TokenCQuote:
+			quotes--
+		case quotes > 0:
+			// interpolations in nested quotes belong to a nested expression,
+			// like "${foo("${bar}")}"
+		case token.Type == hclsyntax.TokenTemplateInterp || token.Type == hclsyntax.TokenTemplateSeqEnd:
+			// more than one interpolation, like "${foo}${bar}"
+			return tokens
+		case token.Type == hclsyntax.TokenQuotedLit:
+			// literal text next to the interpolation
+			return tokens
+		}
+	}
+
+	trimmed := trimTerraformNewlines(inside)
+	if len(trimmed) == 0 {
+		return tokens
+	}
+
+	multiline := false
+	for _, token := range trimmed {
+		if token.Type == hclsyntax.TokenNewline {
+			multiline = true
+			break
+		}
+	}
+
+	wrapped := trimmed[0].Type == hclsyntax.TokenOParen && trimmed[len(trimmed)-1].Type == hclsyntax.TokenCParen
+	if multiline && !wrapped {
+		res := make(hclwrite.Tokens, 0, len(trimmed)+2)
+		res = append(res, &hclwrite.Token{Type: hclsyntax.TokenOParen, Bytes: []byte("(")})
+		res = append(res, trimmed...)
+		res = append(res, &hclwrite.Token{Type: hclsyntax.TokenCParen, Bytes: []byte(")")})
+		return res
+	}
+
+	return trimmed
+}
+
+// formatTerraformTypeExpr replaces the quoted type keywords of terraform 0.11
+// and gives bare collection types their implied element type.
+func formatTerraformTypeExpr(tokens hclwrite.Tokens) hclwrite.Tokens {
+	collection := func(kind, elem string) hclwrite.Tokens {
+		return hclwrite.Tokens{
+			{Type: hclsyntax.TokenIdent, Bytes: []byte(kind)},
+			{Type: hclsyntax.TokenOParen, Bytes: []byte("(")},
+			{Type: hclsyntax.TokenIdent, Bytes: []byte(elem)},
+			{Type: hclsyntax.TokenCParen, Bytes: []byte(")")},
+		}
+	}
+
+	switch len(tokens) {
+	case 1:
+		if tokens[0].Type != hclsyntax.TokenIdent {
+			return tokens
+		}
+
+		switch kind := string(tokens[0].Bytes); kind {
+		case "list", "map", "set":
+			return collection(kind, "any")
+		}
+	case 3:
+		if tokens[0].Type != hclsyntax.TokenOQuote || tokens[1].Type != hclsyntax.TokenQuotedLit || tokens[2].Type != hclsyntax.TokenCQuote {
+			return tokens
+		}
+
+		// terraform 0.11 had no "any", and converted collection elements
+		// to strings
+		switch string(tokens[1].Bytes) {
+		case "string":
+			return hclwrite.Tokens{{Type: hclsyntax.TokenIdent, Bytes: []byte("string")}}
+		case "list":
+			return collection("list", "string")
+		case "map":
+			return collection("map", "string")
+		}
+	}
+
+	return tokens
+}
+
+func trimTerraformNewlines(tokens hclwrite.Tokens) hclwrite.Tokens {
+	start, end := 0, len(tokens)
+	for start < end && tokens[start].Type == hclsyntax.TokenNewline {
+		start++
+	}
+	for end > start && tokens[end-1].Type == hclsyntax.TokenNewline {
+		end--
+	}
+	return tokens[start:end]
+}
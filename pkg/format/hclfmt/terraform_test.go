@@ -0,0 +1,180 @@
+package hclfmt_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mockery"
+	"github.com/walteh/retab/v2/pkg/format/hclfmt"
+)
+
+func TestTerraformFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name: "alignment_and_spacing",
+			src: `resource "aws_instance" "web" {
+  ami="ami-123"
+  instance_type   =   "t2.micro"
+  tags={Name="web"}
+}
+`,
+			expected: `resource "aws_instance" "web" {
+	ami           = "ami-123"
+	instance_type = "t2.micro"
+	tags          = { Name = "web" }
+}
+`,
+		},
+		{
+			name: "interpolation_only_is_unwrapped",
+			src: `locals {
+  a = "${var.a}"
+  b = "${var.b}-suffix"
+  c = "${var.c}${var.d}"
+  d = "${lookup(var.m, "${var.k}")}"
+}
+`,
+			expected: `locals {
+	a = var.a
+	b = "${var.b}-suffix"
+	c = "${var.c}${var.d}"
+	d = lookup(var.m, "${var.k}")
+}
+`,
+		},
+		{
+			name: "multiline_interpolation",
+			src: `locals {
+  a = "${
+    var.enabled ? 1 : 0
+  }"
+}
+`,
+			expected: `locals {
+	a = var.enabled ? 1 : 0
+}
+`,
+		},
+		{
+			name: "multiline_interpolation_gets_parentheses",
+			src: `locals {
+  a = "${var.enabled
+    ? 1
+    : 0}"
+}
+`,
+			expected: `locals {
+	a = (var.enabled
+		? 1
+	: 0)
+}
+`,
+		},
+		{
+			name: "legacy_variable_types",
+			src: `variable "a" {
+  type = "string"
+}
+
+variable "b" {
+  type = "list"
+}
+
+variable "c" {
+  type = map
+}
+
+resource "x" "y" {
+  type = "string"
+}
+`,
+			expected: `variable "a" {
+	type = string
+}
+
+variable "b" {
+	type = list(string)
+}
+
+variable "c" {
+	type = map(any)
+}
+
+resource "x" "y" {
+	type = "string"
+}
+`,
+		},
+		{
+			name: "bare_labels_are_quoted",
+			src: `resource aws_instance web {
+  ami = "ami-123"
+}
+`,
+			expected: `resource "aws_instance" "web" {
+	ami = "ami-123"
+}
+`,
+		},
+		{
+			name: "heredocs_are_kept",
+			src: `resource "x" "y" {
+  script = <<EOT
+  echo   "hi"
+EOT
+  other = <<-EOT
+    indented
+    EOT
+}
+`,
+			expected: `resource "x" "y" {
+	script = <<EOT
+  echo   "hi"
+EOT
+	other  = <<-EOT
+    indented
+    EOT
+}
+`,
+		},
+		{
+			name:     "tfvars",
+			src:      "region=\"us-east-1\"\ninstance_count   = 2\n",
+			expected: "region         = \"us-east-1\"\ninstance_count = 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mockery.NewMockConfiguration_format(t)
+			cfg.EXPECT().UseTabs().Return(true).Maybe()
+			cfg.EXPECT().IndentSize().Return(4).Maybe()
+			cfg.EXPECT().TrimMultipleEmptyLines().Return(false).Maybe()
+			cfg.EXPECT().OneBracketPerLine().Return(false).Maybe()
+			cfg.EXPECT().MaxLineLength().Return(0).Maybe()
+
+			r, err := hclfmt.NewTerraformFormatter().Format(context.Background(), cfg, bytes.NewReader([]byte(tt.src)))
+			require.NoError(t, err, "formatting should succeed")
+
+			result, err := io.ReadAll(r)
+			require.NoError(t, err, "reading formatted content should succeed")
+
+			assert.Equal(t, tt.expected, string(result), "terraform source does not match expected output")
+		})
+	}
+}
+
+func TestTerraformFormatInvalid(t *testing.T) {
+	cfg := mockery.NewMockConfiguration_format(t)
+
+	_, err := hclfmt.NewTerraformFormatter().Format(context.Background(), cfg, bytes.NewReader([]byte("a = \n")))
+	assert.Error(t, err, "invalid terraform should fail to format")
+}
@@ -0,0 +1,300 @@
+package hclfmt
+
+import (
+	"bytes"
+
+	"github.com/apparentlymart/go-textseg/v13/textseg"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+// formatTokens lexes and formats the source, wrapping lines that are longer
+// than the configured maximum.
+func formatTokens(src []byte, cfg format.Configuration) Tokens {
+	tokens := lexConfig(src, cfg)
+	tokens.format()
+
+	maxLineLength := cfg.MaxLineLength()
+	if maxLineLength <= 0 {
+		return tokens
+	}
+
+	// every break puts a bracket pair on more than one line, so it can never
+	// be picked again and this terminates
+	for {
+		opening, closing, kind := findBreak(tokens, cfg.IndentSize(), maxLineLength)
+		if kind == wrapNone {
+			return tokens
+		}
+
+		tokens = breakPair(tokens, opening, closing, kind)
+		tokens.format()
+	}
+}
+
+type wrapKind int
+
+const (
+	wrapNone wrapKind = iota
+	// wrapArgs and wrapTuple keep their commas and get a trailing one
+	wrapArgs
+	wrapTuple
+	// wrapObject separates its items with newlines only
+	wrapObject
+)
+
+// findBreak returns the bracket pair to break on the first line that is too
+// long and can be shortened, see findBreakInLine. Lines spanning heredocs or
+// multi-line comments are never wrapped, and neither is anything inside a
+// template.
+func findBreak(tokens Tokens, indentSize, maxLineLength int) (int, int, wrapKind) {
+	start := 0
+	for start < len(tokens) {
+		end := start
+		for end < len(tokens)-1 && !tokenIsNewline(tokens[end]) && tokens[end].Type != hclsyntax.TokenEOF {
+			end++
+		}
+
+		if width := lineWidth(tokens[start:end+1], indentSize); width > maxLineLength {
+			if p := findBreakInLine(tokens, start, end, indentSize, maxLineLength, width); p != nil {
+				return p.opening, p.closing, p.kind
+			}
+		}
+
+		start = end + 1
+	}
+
+	return -1, -1, wrapNone
+}
+
+// lineWidth returns the rendered width of a line, counting indentation as
+// indentSize columns per level, or -1 when the tokens span several lines.
+func lineWidth(line Tokens, indentSize int) int {
+	width := line[0].TabsBefore * indentSize
+	for i, token := range line {
+		content := token.Bytes
+		if i == len(line)-1 {
+			content = bytes.TrimSuffix(content, []byte("\n"))
+		}
+		if bytes.ContainsRune(content, '\n') {
+			return -1
+		}
+
+		ct, _ := textseg.TokenCount(content, textseg.ScanGraphemeClusters)
+		width += token.SpacesBefore + ct
+	}
+	return width
+}
+
+// pair is a bracket pair on one line that can be broken.
+type pair struct {
+	opening, closing int
+	kind             wrapKind
+	// width is the rendered width from the opening to the closing bracket
+	width int
+}
+
+// findBreakInLine returns the widest pair on the line whose break shortens
+// it, which is the outermost one when pairs are nested, or nil when breaking
+// any pair would not help. A break helps when every line it leaves is
+// narrower than the original one, and the text before the opening and after
+// the closing bracket either fits or holds another pair to break next. So a
+// short call like foo(bar) is left alone when the line is too long because
+// of what follows it.
+func findBreakInLine(tokens Tokens, start, end, indentSize, maxLineLength, width int) *pair {
+	pairs := breakablePairs(tokens, start, end)
+	indent := tokens[start].TabsBefore * indentSize
+
+	var best *pair
+	for _, p := range pairs {
+		head := lineWidth(tokens[start:p.opening+1], indentSize)
+		if head >= width || (head > maxLineLength && !pairBetween(pairs, start, p.opening)) {
+			continue
+		}
+
+		tail := indent + spanWidth(tokens[p.closing:end+1])
+		if tail >= width || (tail > maxLineLength && !pairBetween(pairs, p.closing, end)) {
+			continue
+		}
+
+		narrower := true
+		for _, item := range pairItems(tokens, p.opening, p.closing) {
+			if indent+NumSpacesPerIndent*indentSize+spanWidth(item)+1 >= width {
+				narrower = false
+				break
+			}
+		}
+		if !narrower {
+			continue
+		}
+
+		if best == nil || p.width > best.width {
+			best = p
+		}
+	}
+
+	return best
+}
+
+// breakablePairs returns every pair between start and end that can be
+// broken, outer ones before the ones nested in them.
+func breakablePairs(tokens Tokens, start, end int) []*pair {
+	pairs := []*pair{}
+	for i := start; i <= end; i++ {
+		token := tokens[i]
+		switch token.Type {
+		case hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl:
+			closing := matchingBracket(tokens, i, end)
+			if closing < 0 {
+				return pairs
+			}
+			i = closing
+		case hclsyntax.TokenOParen, hclsyntax.TokenOBrack, hclsyntax.TokenOBrace:
+			closing := matchingBracket(tokens, i, end)
+			if closing < 0 || closing == i+1 {
+				continue
+			}
+			if hclsyntax.Keyword([]byte("for")).TokenMatches(asHCLSyntax(tokens[i+1])) {
+				// breaking anything inside a for expression reads badly
+				i = closing
+				continue
+			}
+			if kind := pairKind(tokens, i); kind != wrapNone {
+				pairs = append(pairs, &pair{opening: i, closing: closing, kind: kind, width: spanWidth(tokens[i : closing+1])})
+			}
+		}
+	}
+	return pairs
+}
+
+// pairBetween reports whether one of the pairs lies strictly between the
+// tokens at from and to.
+func pairBetween(pairs []*pair, from, to int) bool {
+	for _, p := range pairs {
+		if p.opening > from && p.closing < to {
+			return true
+		}
+	}
+	return false
+}
+
+// spanWidth returns the rendered width of tokens on one line, without the
+// spaces before the first one and the newline after the last one, or -1 when
+// they span several lines.
+func spanWidth(span Tokens) int {
+	width := 0
+	for i, token := range span {
+		content := token.Bytes
+		if i == len(span)-1 {
+			content = bytes.TrimSuffix(content, []byte("\n"))
+		}
+		if bytes.ContainsRune(content, '\n') {
+			return -1
+		}
+
+		ct, _ := textseg.TokenCount(content, textseg.ScanGraphemeClusters)
+		if i > 0 {
+			width += token.SpacesBefore
+		}
+		width += ct
+	}
+	return width
+}
+
+// matchingBracket returns the index of the token closing the one at opening,
+// or -1 when it is not closed by end.
+func matchingBracket(tokens Tokens, opening, end int) int {
+	depth := 0
+	for i := opening; i <= end; i++ {
+		depth += tokenBracketChange(tokens[i])
+		if depth == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+func pairKind(tokens Tokens, opening int) wrapKind {
+	prev := hclsyntax.TokenNil
+	if opening > 0 {
+		prev = tokens[opening-1].Type
+	}
+
+	switch tokens[opening].Type {
+	case hclsyntax.TokenOParen:
+		if prev == hclsyntax.TokenIdent {
+			return wrapArgs
+		}
+	case hclsyntax.TokenOBrack:
+		switch prev {
+		case hclsyntax.TokenIdent, hclsyntax.TokenCBrack, hclsyntax.TokenCParen, hclsyntax.TokenCBrace, hclsyntax.TokenCQuote:
+			// an index
+		default:
+			return wrapTuple
+		}
+	case hclsyntax.TokenOBrace:
+		switch prev {
+		case hclsyntax.TokenEqual, hclsyntax.TokenComma, hclsyntax.TokenOParen, hclsyntax.TokenOBrack, hclsyntax.TokenColon, hclsyntax.TokenQuestion, hclsyntax.TokenFatArrow:
+			return wrapObject
+		}
+	}
+
+	return wrapNone
+}
+
+// pairItems splits the tokens between the brackets at opening and closing
+// on their top level commas. A trailing comma leaves an empty last item.
+func pairItems(tokens Tokens, opening, closing int) []Tokens {
+	items := []Tokens{}
+	item := Tokens{}
+	depth := 0
+	for _, token := range tokens[opening+1 : closing] {
+		if depth == 0 && token.Type == hclsyntax.TokenComma {
+			items = append(items, item)
+			item = Tokens{}
+			continue
+		}
+		depth += tokenBracketChange(token)
+		item = append(item, token)
+	}
+	return append(items, item)
+}
+
+// breakPair puts every item between the brackets at opening and closing on
+// its own line.
+func breakPair(tokens Tokens, opening, closing int, kind wrapKind) Tokens {
+	out := Tokens{tokens[opening]}
+	for _, item := range pairItems(tokens, opening, closing) {
+		if len(item) == 0 {
+			// a trailing comma
+			continue
+		}
+
+		out = append(out, newlineBefore(item[0]))
+		out = append(out, item...)
+
+		// hcl does not allow a comma after an expanded last argument
+		last := item[len(item)-1]
+		if kind != wrapObject && last.Type != hclsyntax.TokenEllipsis {
+			out = append(out, &Token{
+				Token:       hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")},
+				SourceRange: last.SourceRange,
+			})
+		}
+	}
+	out = append(out, newlineBefore(tokens[closing]), tokens[closing])
+
+	res := make(Tokens, 0, len(tokens)+len(out))
+	res = append(res, tokens[:opening]...)
+	res = append(res, out...)
+	res = append(res, tokens[closing+1:]...)
+	return res
+}
+
+func newlineBefore(next *Token) *Token {
+	return &Token{
+		Token:       hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")},
+		SourceRange: next.SourceRange,
+	}
+}
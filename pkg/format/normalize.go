@@ -0,0 +1,157 @@
+package format
+
+import (
+	"bytes"
+
+	"gitlab.com/tozd/go/errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// charsetEncoding returns the encoding for an editorconfig charset, or nil
+// for utf-8 and unset charsets.
+func charsetEncoding(charset string) (encoding.Encoding, error) {
+	switch charset {
+	case "", "unset", "utf-8", "utf-8-bom":
+		return nil, nil
+	case "latin1":
+		return charmap.ISO8859_1, nil
+	case "utf-16be":
+		return unicode.UTF16(unicode.BigEndian, unicode.UseBOM), nil
+	case "utf-16le":
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), nil
+	default:
+		return nil, errors.Errorf("unsupported charset: %q", charset)
+	}
+}
+
+// decodeInput turns the input into utf-8 with lf line endings, so providers
+// never have to deal with the charset or end_of_line settings.
+func decodeInput(cfg Configuration, input []byte) ([]byte, error) {
+	input, err := decodeCharset(cfg, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if lineEnding(cfg.EndOfLine()) != "" {
+		input = normalizeLineEndings(input)
+	}
+
+	return input, nil
+}
+
+// decodeCharset turns the input into utf-8 without a byte order mark, which
+// is the text editors show and text edits refer to.
+func decodeCharset(cfg Configuration, input []byte) ([]byte, error) {
+	enc, err := charsetEncoding(cfg.Charset())
+	if err != nil {
+		return nil, err
+	}
+
+	if enc != nil {
+		input, err = enc.NewDecoder().Bytes(input)
+		if err != nil {
+			return nil, errors.Errorf("decoding %s: %w", cfg.Charset(), err)
+		}
+	}
+
+	if cfg.Charset() == "utf-8-bom" {
+		input = bytes.TrimPrefix(input, utf8BOM)
+	}
+
+	return input, nil
+}
+
+// encodeOutput applies the editorconfig settings every provider shares to
+// the formatted content: trailing whitespace, the final newline, line
+// endings and the charset.
+func encodeOutput(cfg Configuration, output []byte) ([]byte, error) {
+	return encodeCharset(cfg, finishText(cfg, output))
+}
+
+// finishText applies the settings of encodeOutput that change the text:
+// trailing whitespace, the final newline and line endings.
+func finishText(cfg Configuration, output []byte) []byte {
+	if cfg.TrimTrailingWhitespace() {
+		output = trimTrailingWhitespace(output)
+	}
+
+	if insert := cfg.InsertFinalNewline(); insert != nil && len(output) > 0 {
+		if !*insert {
+			output = bytes.TrimRight(output, "\r\n")
+		} else if !bytes.HasSuffix(output, []byte("\n")) {
+			// without end_of_line, keep the line ending the content already uses
+			nl := []byte("\n")
+			if bytes.Contains(output, []byte("\r\n")) {
+				nl = []byte("\r\n")
+			}
+			output = append(output, nl...)
+		}
+	}
+
+	if eol := lineEnding(cfg.EndOfLine()); eol != "" && eol != "\n" {
+		output = bytes.ReplaceAll(output, []byte("\n"), []byte(eol))
+	}
+
+	return output
+}
+
+// encodeCharset turns utf-8 output into the configured charset.
+func encodeCharset(cfg Configuration, output []byte) ([]byte, error) {
+	if cfg.Charset() == "utf-8-bom" {
+		output = append(append([]byte{}, utf8BOM...), output...)
+	}
+
+	enc, err := charsetEncoding(cfg.Charset())
+	if err != nil {
+		return nil, err
+	}
+
+	if enc != nil {
+		output, err = enc.NewEncoder().Bytes(output)
+		if err != nil {
+			return nil, errors.Errorf("encoding %s: %w", cfg.Charset(), err)
+		}
+	}
+
+	return output, nil
+}
+
+func lineEnding(endOfLine string) string {
+	switch endOfLine {
+	case "lf":
+		return "\n"
+	case "crlf":
+		return "\r\n"
+	case "cr":
+		return "\r"
+	default:
+		return ""
+	}
+}
+
+func normalizeLineEndings(content []byte) []byte {
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(content, []byte("\r"), []byte("\n"))
+}
+
+func trimTrailingWhitespace(content []byte) []byte {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	var buf bytes.Buffer
+	buf.Grow(len(content))
+	for _, line := range lines {
+		body := bytes.TrimSuffix(line, []byte("\n"))
+		eol := line[len(body):]
+		cr := bytes.HasSuffix(body, []byte("\r"))
+		body = bytes.TrimRight(body, " \t\r")
+		buf.Write(body)
+		if cr && len(eol) > 0 {
+			buf.WriteByte('\r')
+		}
+		buf.Write(eol)
+	}
+	return buf.Bytes()
+}
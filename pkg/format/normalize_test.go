@@ -0,0 +1,223 @@
+package format_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mockery"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+// identityProvider returns its input unchanged and remembers it, so the
+// shared stages can be tested on their own.
+type identityProvider struct {
+	seen []byte
+}
+
+func (me *identityProvider) Targets() []string {
+	return []string{"*"}
+}
+
+func (me *identityProvider) Format(ctx context.Context, cfg format.Configuration, reader io.Reader) (io.Reader, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	me.seen = content
+	return bytes.NewReader(content), nil
+}
+
+type staticConfigurationProvider struct {
+	cfg format.Configuration
+}
+
+func (me *staticConfigurationProvider) GetConfigurationForFileType(ctx context.Context, filename string) (format.Configuration, error) {
+	return me.cfg, nil
+}
+
+func TestFormatAppliesEditorconfigKeys(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name               string
+		endOfLine          string
+		insertFinalNewline *bool
+		trimTrailing       bool
+		charset            string
+		input              []byte
+		seen               string
+		expected           []byte
+	}{
+		{
+			name:     "nothing_set",
+			input:    []byte("a = 1  \r\nb = 2"),
+			seen:     "a = 1  \r\nb = 2",
+			expected: []byte("a = 1  \r\nb = 2"),
+		},
+		{
+			name:      "end_of_line_crlf",
+			endOfLine: "crlf",
+			input:     []byte("a = 1\nb = 2\r\n"),
+			seen:      "a = 1\nb = 2\n",
+			expected:  []byte("a = 1\r\nb = 2\r\n"),
+		},
+		{
+			name:      "end_of_line_lf",
+			endOfLine: "lf",
+			input:     []byte("a = 1\r\nb = 2\r\n"),
+			seen:      "a = 1\nb = 2\n",
+			expected:  []byte("a = 1\nb = 2\n"),
+		},
+		{
+			name:               "insert_final_newline_true",
+			insertFinalNewline: &yes,
+			input:              []byte("a = 1"),
+			seen:               "a = 1",
+			expected:           []byte("a = 1\n"),
+		},
+		{
+			name:               "insert_final_newline_true_keeps_crlf",
+			insertFinalNewline: &yes,
+			input:              []byte("a = 1\r\nb = 2"),
+			seen:               "a = 1\r\nb = 2",
+			expected:           []byte("a = 1\r\nb = 2\r\n"),
+		},
+		{
+			name:               "insert_final_newline_false",
+			insertFinalNewline: &no,
+			input:              []byte("a = 1\n\n"),
+			seen:               "a = 1\n\n",
+			expected:           []byte("a = 1"),
+		},
+		{
+			name:         "trim_trailing_whitespace",
+			endOfLine:    "crlf",
+			trimTrailing: true,
+			input:        []byte("a = 1 \t\r\nb = 2  "),
+			seen:         "a = 1 \t\nb = 2  ",
+			expected:     []byte("a = 1\r\nb = 2"),
+		},
+		{
+			name:     "charset_utf8_bom",
+			charset:  "utf-8-bom",
+			input:    []byte("\xEF\xBB\xBFa = \"é\"\n"),
+			seen:     "a = \"é\"\n",
+			expected: []byte("\xEF\xBB\xBFa = \"é\"\n"),
+		},
+		{
+			name:     "charset_utf8_bom_added",
+			charset:  "utf-8-bom",
+			input:    []byte("a = 1\n"),
+			seen:     "a = 1\n",
+			expected: []byte("\xEF\xBB\xBFa = 1\n"),
+		},
+		{
+			name:     "charset_latin1",
+			charset:  "latin1",
+			input:    []byte("a = \"\xE9\"\n"),
+			seen:     "a = \"é\"\n",
+			expected: []byte("a = \"\xE9\"\n"),
+		},
+		{
+			name:     "charset_utf16le",
+			charset:  "utf-16le",
+			input:    []byte("\xFF\xFEa\x00\n\x00"),
+			seen:     "a\n",
+			expected: []byte("\xFF\xFEa\x00\n\x00"),
+		},
+		{
+			name:     "charset_utf16be",
+			charset:  "utf-16be",
+			input:    []byte("\xFE\xFF\x00a\x00\n"),
+			seen:     "a\n",
+			expected: []byte("\xFE\xFF\x00a\x00\n"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mockery.NewMockConfiguration_format(t)
+			cfg.EXPECT().EndOfLine().Return(tt.endOfLine).Maybe()
+			cfg.EXPECT().InsertFinalNewline().Return(tt.insertFinalNewline).Maybe()
+			cfg.EXPECT().TrimTrailingWhitespace().Return(tt.trimTrailing).Maybe()
+			cfg.EXPECT().Charset().Return(tt.charset).Maybe()
+
+			provider := &identityProvider{}
+			r, err := format.Format(context.Background(), provider, &staticConfigurationProvider{cfg}, "file.txt", bytes.NewReader(tt.input))
+			require.NoError(t, err, "formatting should succeed")
+
+			result, err := io.ReadAll(r)
+			require.NoError(t, err, "reading formatted content should succeed")
+
+			assert.Equal(t, tt.seen, string(provider.seen), "provider should see decoded utf-8 content")
+			assert.Equal(t, tt.expected, result, "output should follow the editorconfig keys")
+		})
+	}
+}
+
+func TestFormatRejectsUnknownCharset(t *testing.T) {
+	cfg := mockery.NewMockConfiguration_format(t)
+	cfg.EXPECT().Charset().Return("ebcdic").Maybe()
+	cfg.EXPECT().EndOfLine().Return("").Maybe()
+
+	_, err := format.Format(context.Background(), &identityProvider{}, &staticConfigurationProvider{cfg}, "file.txt", bytes.NewReader([]byte("a")))
+	assert.Error(t, err, "unknown charsets should be reported")
+}
+
+// upperProvider uppercases the content and, like most formatters, writes lf
+// line endings.
+type upperProvider struct{}
+
+func (me *upperProvider) Targets() []string {
+	return []string{"*"}
+}
+
+func (me *upperProvider) Format(ctx context.Context, cfg format.Configuration, reader io.Reader) (io.Reader, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(strings.ToUpper(strings.ReplaceAll(string(content), "\r\n", "\n"))), nil
+}
+
+func TestFormatRangeAppliesEditorconfigKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		endOfLine string
+		charset   string
+		input     []byte
+		expected  []*format.TextEdit
+	}{
+		{
+			name:      "end_of_line_crlf",
+			endOfLine: "crlf",
+			input:     []byte("A\r\nb\r\nC\r\n"),
+			expected:  []*format.TextEdit{{Start: format.Position{Line: 1}, End: format.Position{Line: 2}, NewText: "B\r\n"}},
+		},
+		{
+			name:     "charset_utf16le",
+			charset:  "utf-16le",
+			input:    []byte("\xFF\xFEA\x00\n\x00b\x00\n\x00C\x00\n\x00"),
+			expected: []*format.TextEdit{{Start: format.Position{Line: 1}, End: format.Position{Line: 2}, NewText: "B\n"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mockery.NewMockConfiguration_format(t)
+			cfg.EXPECT().EndOfLine().Return(tt.endOfLine).Maybe()
+			cfg.EXPECT().InsertFinalNewline().Return(nil).Maybe()
+			cfg.EXPECT().TrimTrailingWhitespace().Return(false).Maybe()
+			cfg.EXPECT().Charset().Return(tt.charset).Maybe()
+
+			edits, err := format.FormatRange(context.Background(), &upperProvider{}, &staticConfigurationProvider{cfg}, "file.txt", tt.input, format.LineRange{Start: 1, End: 1})
+			require.NoError(t, err, "formatting should succeed")
+			assert.Equal(t, tt.expected, edits, "edits should refer to the decoded text and keep its line endings")
+		})
+	}
+}
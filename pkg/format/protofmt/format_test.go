@@ -3,6 +3,7 @@ package protofmt_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"strings"
 	"testing"
@@ -333,3 +334,64 @@ func TestBasicFieldAlignment(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatRange(t *testing.T) {
+	input := "syntax = \"proto3\";\n\nmessage A {\n  string a = 1;\n}\n\nmessage B {\n  string b = 1;\n}\n"
+	expected := "syntax = \"proto3\";\n\nmessage A {\n  string a = 1;\n}\n\nmessage B {\n\tstring b = 1;\n}\n"
+
+	cfg := mockery.NewMockConfiguration_format(t)
+	cfg.EXPECT().UseTabs().Return(true).Maybe()
+	cfg.EXPECT().IndentSize().Return(1).Maybe()
+
+	edits, err := protofmt.NewFormatter().FormatRange(context.Background(), cfg, []byte(input), format.LineRange{Start: 7, End: 7})
+	if err != nil {
+		t.Fatalf("FormatRange returned error: %v", err)
+	}
+
+	got, err := format.ApplyEdits([]byte(input), edits)
+	if err != nil {
+		t.Fatalf("ApplyEdits returned error: %v", err)
+	}
+
+	if string(got) != expected {
+		t.Errorf("FormatRange changed lines outside the range.\nExpected:\n%s\nGot:\n%s",
+			visualizeWhitespace(expected),
+			visualizeWhitespace(string(got)))
+	}
+}
+
+func TestSniff(t *testing.T) {
+	fmtr := protofmt.NewFormatter()
+
+	tests := []struct {
+		content  string
+		expected bool
+	}{
+		{content: "syntax = \"proto3\";\nmessage A {}\n", expected: true},
+		{content: "a = 1\n", expected: false},
+		{content: "", expected: false},
+	}
+
+	for _, tt := range tests {
+		if got := fmtr.Sniff([]byte(tt.content)); got != tt.expected {
+			t.Errorf("Sniff(%q) = %v, expected %v", tt.content, got, tt.expected)
+		}
+	}
+}
+
+func TestParseErrorDiagnostics(t *testing.T) {
+	_, err := protofmt.NewFormatter().Format(context.Background(), nil, strings.NewReader("syntax = \"proto3\";\nmessage A {\n\tstring a = ;\n}\n"))
+	if err == nil {
+		t.Fatal("invalid protobuf should fail")
+	}
+
+	var carrier format.DiagnosticsCarrier
+	if !errors.As(err, &carrier) || len(carrier.Diagnostics()) == 0 {
+		t.Fatalf("the error should carry diagnostics, got %v", err)
+	}
+
+	diag := carrier.Diagnostics()[0]
+	if diag.Line != 3 || diag.Column != 13 || diag.Severity != format.SeverityError || diag.Source != "proto" {
+		t.Errorf("unexpected diagnostic: %+v", diag)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"context"
 	"io"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/walteh/retab/v2/pkg/format"
 
+	"github.com/bufbuild/protocompile/ast"
 	"github.com/bufbuild/protocompile/parser"
 	"github.com/bufbuild/protocompile/reporter"
 	"gitlab.com/tozd/go/errors"
@@ -17,6 +19,12 @@ type Formatter struct {
 }
 
 var _ format.Provider = (*Formatter)(nil)
+var _ format.RangeProvider = (*Formatter)(nil)
+var _ format.Sniffer = (*Formatter)(nil)
+
+func init() {
+	format.MustRegister(&format.Registration{Name: "proto", Aliases: []string{"protobuf", "proto3"}, Provider: NewFormatter(), Capabilities: format.CapabilityDiagnostics})
+}
 
 func NewFormatter() *Formatter {
 	return &Formatter{}
@@ -26,17 +34,119 @@ func (me *Formatter) Targets() []string {
 	return []string{"*.proto", "*.proto3"}
 }
 
+// parse parses the whole file and returns every syntax error it finds as a
+// *format.DiagnosticsError.
+func parse(read io.Reader) (*ast.FileNode, error) {
+	src, err := io.ReadAll(read)
+	if err != nil {
+		return nil, errors.Errorf("reading protobuf: %w", err)
+	}
+
+	diags := []*format.Diagnostic{}
+	rep := reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+		start, end := err.Start(), err.End()
+		diags = append(diags, &format.Diagnostic{
+			Line:      start.Line,
+			Column:    column(src, start.Offset),
+			EndLine:   end.Line,
+			EndColumn: column(src, end.Offset),
+			Severity:  format.SeverityError,
+			Message:   err.Unwrap().Error(),
+			Source:    "proto",
+		})
+		return nil
+	}, nil)
+
+	fileNode, err := parser.Parse("retab.protobuf-parser", bytes.NewReader(src), reporter.NewHandler(rep))
+	if len(diags) > 0 {
+		return nil, &format.DiagnosticsError{List: diags, Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return fileNode, nil
+}
+
+// column returns the one-based column of the byte offset in characters, the
+// parser counts tabs up to the next multiple of eight.
+func column(src []byte, offset int) int {
+	offset = min(max(offset, 0), len(src))
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	return utf8.RuneCount(src[start:offset]) + 1
+}
+
+// Sniff accepts content that parses as protobuf without errors and has at
+// least one declaration.
+func (me *Formatter) Sniff(head []byte) bool {
+	fileNode, err := parse(bytes.NewReader(head))
+	if err != nil {
+		return false
+	}
+
+	return fileNode.Syntax != nil || fileNode.Edition != nil || len(fileNode.Decls) > 0
+}
+
 func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
-	fileNode, err := parser.Parse("retab.protobuf-parser", read, reporter.NewHandler(nil))
+	fileNode, err := parse(read)
 	if err != nil {
 		return nil, errors.Errorf("failed to parse protobuf: %w", err)
 	}
 
+	result, err := formatFileNode(fileNode, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.NewReader(result), nil
+}
+
+// FormatRange formats the whole file but only keeps the changes within the
+// top-level declarations that touch the range, so a partially selected
+// message is always formatted as a whole.
+func (me *Formatter) FormatRange(ctx context.Context, cfg format.Configuration, src []byte, rng format.LineRange) ([]*format.TextEdit, error) {
+	fileNode, err := parse(bytes.NewReader(src))
+	if err != nil {
+		return nil, errors.Errorf("failed to parse protobuf: %w", err)
+	}
+
+	result, err := formatFileNode(fileNode, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	decls := []ast.Node{}
+	if fileNode.Syntax != nil {
+		decls = append(decls, fileNode.Syntax)
+	}
+	if fileNode.Edition != nil {
+		decls = append(decls, fileNode.Edition)
+	}
+	for _, decl := range fileNode.Decls {
+		decls = append(decls, decl)
+	}
+
+	// each declaration owns the lines after the previous one, which
+	// includes its leading comments; source positions are one-based
+	lo, hi := rng.Start+1, rng.End+1
+	prevEnd := 0
+	for _, decl := range decls {
+		start, end := prevEnd+1, fileNode.NodeInfo(decl).End().Line
+		if end >= lo && start <= hi {
+			lo, hi = min(lo, start), max(hi, end)
+		}
+		prevEnd = end
+	}
+
+	return format.LineEdits(src, []byte(result), &format.LineRange{Start: lo - 1, End: hi - 1}), nil
+}
+
+func formatFileNode(fileNode *ast.FileNode, cfg format.Configuration) (string, error) {
 	var buf bytes.Buffer
 	fmtr := newFormatter(&buf, fileNode, cfg)
 
 	if err := fmtr.Run(); err != nil {
-		return nil, errors.Errorf("failed to format: %w", err)
+		return "", errors.Errorf("failed to format: %w", err)
 	}
 
 	// Do the replacements after formatting
@@ -45,5 +155,5 @@ func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read
 		result = strings.Replace(result, id, value, -1)
 	}
 
-	return strings.NewReader(result), nil
+	return result, nil
 }
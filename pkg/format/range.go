@@ -0,0 +1,228 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/rs/zerolog"
+	"gitlab.com/tozd/go/errors"
+)
+
+// LineRange is a zero-based, inclusive range of lines.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// overlaps reports whether the half-open range of lines [i1, i2) touches the
+// range. Pure insertions touch it if they happen inside it or directly after
+// its last line.
+func (me LineRange) overlaps(i1, i2 int) bool {
+	if i1 == i2 {
+		return i1 >= me.Start && i1 <= me.End+1
+	}
+	return i1 <= me.End && i2-1 >= me.Start
+}
+
+// Position is a zero-based line and column. Columns count utf-16 code units,
+// which is what editors and the language server protocol expect.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// TextEdit replaces the text between Start and End with NewText.
+type TextEdit struct {
+	Start   Position
+	End     Position
+	NewText string
+}
+
+// RangeProvider is implemented by providers that can format part of a file
+// natively. The edits may cover more than the requested range, for example
+// to include whole tokens or declarations.
+type RangeProvider interface {
+	Provider
+	FormatRange(ctx context.Context, cfg Configuration, src []byte, rng LineRange) ([]*TextEdit, error)
+}
+
+// FormatRange formats the given lines of the file and returns the edits to
+// apply. Like Format, the content is decoded from its charset and the shared
+// editorconfig settings are applied, the edits refer to the decoded text with
+// its line endings as they are. Providers that do not implement
+// RangeProvider format the whole file, and only the changes touching the
+// range are kept.
+func FormatRange(ctx context.Context, provider Provider, cfg ConfigurationProvider, filename string, src []byte, rng LineRange) ([]*TextEdit, error) {
+	ctx = zerolog.Ctx(ctx).With().Str("path", filename).Str("provider", reflect.TypeOf(provider).Elem().String()).Logger().WithContext(ctx)
+	ctx = WithFilename(ctx, filename)
+
+	efg, err := cfg.GetConfigurationForFileType(ctx, filename)
+	if err != nil {
+		return nil, errors.Errorf("failed to get editorconfig: %w", err)
+	}
+
+	text, err := decodeCharset(efg, src)
+	if err != nil {
+		return nil, errors.Errorf("failed to decode content: %w", err)
+	}
+
+	input, err := decodeInput(efg, src)
+	if err != nil {
+		return nil, errors.Errorf("failed to decode content: %w", err)
+	}
+
+	var formatted []byte
+	if rp, ok := provider.(RangeProvider); ok {
+		edits, err := rp.FormatRange(ctx, efg, input, rng)
+		if err != nil {
+			return nil, errors.Errorf("failed to format range: %w", withFilename(err, filename))
+		}
+
+		formatted, err = ApplyEdits(input, edits)
+		if err != nil {
+			return nil, errors.Errorf("failed to apply range edits: %w", err)
+		}
+
+		// the provider may change more than the range, keep all of it
+		for _, edit := range edits {
+			end := edit.End.Line
+			if edit.End.Column == 0 && end > edit.Start.Line {
+				end--
+			}
+			rng = LineRange{Start: min(rng.Start, edit.Start.Line), End: max(rng.End, end)}
+		}
+	} else {
+		r, err := provider.Format(ctx, efg, bytes.NewReader(input))
+		if err != nil {
+			return nil, errors.Errorf("failed to format: %w", withFilename(err, filename))
+		}
+
+		formatted, err = io.ReadAll(r)
+		if err != nil {
+			return nil, errors.Errorf("failed to read formatted content: %w", err)
+		}
+	}
+
+	return LineEdits(text, finishText(efg, formatted), &rng), nil
+}
+
+// LineEdits returns one edit per changed block of lines between the original
+// and formatted content. When rng is set, only the blocks that touch it are
+// returned.
+func LineEdits(original, formatted []byte, rng *LineRange) []*TextEdit {
+	a := SplitLines(original)
+	b := SplitLines(formatted)
+
+	edits := []*TextEdit{}
+	matcher := difflib.NewMatcherWithJunk(a, b, false, nil)
+	for _, op := range matcher.GetOpCodes() {
+		if op.Tag == 'e' {
+			continue
+		}
+
+		if rng != nil && !rng.overlaps(op.I1, op.I2) {
+			continue
+		}
+
+		edits = append(edits, &TextEdit{
+			Start:   Position{Line: op.I1},
+			End:     LineStart(a, op.I2),
+			NewText: strings.Join(b[op.J1:op.J2], ""),
+		})
+	}
+
+	return edits
+}
+
+// LineStart returns the position at the start of line i, or the end of the
+// content when i is past the last line.
+func LineStart(lines []string, i int) Position {
+	if i < len(lines) || len(lines) == 0 {
+		return Position{Line: i}
+	}
+
+	last := lines[len(lines)-1]
+	if strings.HasSuffix(last, "\n") {
+		return Position{Line: len(lines)}
+	}
+
+	return Position{Line: len(lines) - 1, Column: UTF16Len(last)}
+}
+
+// ApplyEdits applies non-overlapping edits to the content. The edits may be
+// in any order.
+func ApplyEdits(content []byte, edits []*TextEdit) ([]byte, error) {
+	lines := SplitLines(content)
+
+	offset := func(pos Position) (int, error) {
+		off := 0
+		for i := 0; i < pos.Line && i < len(lines); i++ {
+			off += len(lines[i])
+		}
+		if pos.Line >= len(lines) {
+			if pos.Line > len(lines) || pos.Column > 0 {
+				return 0, errors.Errorf("position %d:%d is past the end of the content", pos.Line, pos.Column)
+			}
+			return off, nil
+		}
+
+		units := 0
+		for i, r := range lines[pos.Line] {
+			if units >= pos.Column {
+				return off + i, nil
+			}
+			units += len(utf16.Encode([]rune{r}))
+		}
+		if units < pos.Column {
+			return 0, errors.Errorf("position %d:%d is past the end of the line", pos.Line, pos.Column)
+		}
+		return off + len(lines[pos.Line]), nil
+	}
+
+	type span struct {
+		start, end int
+		text       string
+	}
+
+	spans := make([]span, 0, len(edits))
+	for _, edit := range edits {
+		start, err := offset(edit.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := offset(edit.End)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, span{start, end, edit.NewText})
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	var buf bytes.Buffer
+	last := 0
+	for _, s := range spans {
+		if s.start < last || s.end < s.start {
+			return nil, errors.New("edits overlap")
+		}
+		buf.Write(content[last:s.start])
+		buf.WriteString(s.text)
+		last = s.end
+	}
+	buf.Write(content[last:])
+
+	return buf.Bytes(), nil
+}
+
+// UTF16Len returns the length of the string in utf-16 code units.
+func UTF16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
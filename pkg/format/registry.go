@@ -0,0 +1,293 @@
+package format
+
+import (
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"gitlab.com/tozd/go/errors"
+)
+
+// ErrNoFormatter is returned when no provider handles a file.
+var ErrNoFormatter = errors.Base("no formatters found")
+
+// Capability is a feature a provider has beyond formatting whole files.
+type Capability uint
+
+const (
+	// CapabilityRange is set for providers that format a line range on their
+	// own. It is added for every provider implementing RangeProvider.
+	CapabilityRange Capability = 1 << iota
+	// CapabilityDiagnostics is set for providers that are cheap enough to run
+	// on every change to report parse errors, which rules out commands.
+	CapabilityDiagnostics
+)
+
+// Registration is a provider known to a Registry under a name.
+type Registration struct {
+	// Name selects the provider explicitly, like "hcl" in --formatter=hcl.
+	Name string
+	// Aliases are other names the language goes by in modelines and
+	// shebangs, like "terraform" for "tf". See Registry.Sniff.
+	Aliases  []string
+	Provider Provider
+	// Targets are the globs matched for auto-detection. Empty uses the
+	// provider's own Targets.
+	Targets []string
+	// Priority decides between providers matching the same file, the higher
+	// one wins. Ties go to the more specific target, then to the later
+	// registration.
+	Priority     int
+	Capabilities Capability
+}
+
+// Has reports whether the provider has the capability.
+func (me *Registration) Has(c Capability) bool {
+	return me.Capabilities&c == c
+}
+
+// Matches reports whether one of the targets matches the path, which should
+// be relative to the project root like in Explain.
+func (me *Registration) Matches(path string) (bool, error) {
+	return matchTargets(me.Targets, strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "./"))
+}
+
+// Registry maps names and file globs to providers.
+type Registry struct {
+	mu            sync.RWMutex
+	registrations []*Registration
+}
+
+// DefaultRegistry holds the builtin providers, which register themselves
+// when their package is imported, and any registered with Register.
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds the provider to the default registry.
+func Register(reg *Registration) error {
+	return DefaultRegistry.Register(reg)
+}
+
+// MustRegister is Register for init functions, it panics on error.
+func MustRegister(reg *Registration) {
+	if err := Register(reg); err != nil {
+		panic(err)
+	}
+}
+
+// Register adds the provider to the registry. Names must be unique.
+func (me *Registry) Register(reg *Registration) error {
+	if reg.Name == "" || reg.Name == "auto" {
+		return errors.Errorf("invalid formatter name: %q", reg.Name)
+	}
+	if reg.Provider == nil {
+		return errors.Errorf("formatter %q has no provider", reg.Name)
+	}
+
+	reg = &Registration{
+		Name:         reg.Name,
+		Aliases:      reg.Aliases,
+		Provider:     reg.Provider,
+		Targets:      reg.Targets,
+		Priority:     reg.Priority,
+		Capabilities: reg.Capabilities,
+	}
+	if len(reg.Targets) == 0 {
+		reg.Targets = reg.Provider.Targets()
+	}
+	if _, ok := reg.Provider.(RangeProvider); ok {
+		reg.Capabilities |= CapabilityRange
+	}
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	for _, existing := range me.registrations {
+		if existing.Name == reg.Name {
+			return errors.Errorf("formatter %q is already registered", reg.Name)
+		}
+	}
+
+	me.registrations = append(me.registrations, reg)
+
+	return nil
+}
+
+// Lookup returns the provider registered under the name.
+func (me *Registry) Lookup(name string) (*Registration, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	for _, reg := range me.registrations {
+		if reg.Name == name {
+			return reg, nil
+		}
+	}
+
+	return nil, errors.Errorf("invalid formatter type: %q", name)
+}
+
+// Match is a registered provider with one of its targets matching a path.
+type Match struct {
+	Registration *Registration
+	// Target is the most specific of the targets that matched.
+	Target string
+	// Specificity counts the literal characters of the target, patterns
+	// with more of them describe the path more precisely.
+	Specificity int
+
+	order int
+}
+
+// Detection is the answer to which provider handles a path and why.
+type Detection struct {
+	// Path is what the targets were matched against.
+	Path string
+	// Matches has every provider matching the path, the one that handles
+	// it first. They are ordered by priority, then by specificity, and then
+	// later registrations and targets before earlier ones.
+	Matches []*Match
+}
+
+// Winner returns the registration that handles the path, or nil when no
+// provider does.
+func (me *Detection) Winner() *Registration {
+	if len(me.Matches) == 0 {
+		return nil
+	}
+	return me.Matches[0].Registration
+}
+
+// Detect returns the provider whose targets match the path best, or nil when
+// none does. See Explain.
+func (me *Registry) Detect(path string) (*Registration, error) {
+	detection, err := me.Explain(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return detection.Winner(), nil
+}
+
+// Explain matches the path against the targets of every provider. Targets
+// without a slash match the base name of the path, like "*.hcl". Targets
+// with one match the whole path, which should be relative to the project
+// root, like "deploy/**/*.hcl" or "/.retab/*.retab".
+func (me *Registry) Explain(path string) (*Detection, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	path = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "./")
+	detection := &Detection{Path: path, Matches: []*Match{}}
+
+	for i, reg := range me.registrations {
+		var best *Match
+		for _, target := range reg.Targets {
+			ok, err := MatchTarget(target, path)
+			if err != nil {
+				return nil, errors.Errorf("matching targets of %q: %w", reg.Name, err)
+			}
+			if !ok {
+				continue
+			}
+
+			if specificity := targetSpecificity(target); best == nil || specificity >= best.Specificity {
+				best = &Match{Registration: reg, Target: target, Specificity: specificity, order: i}
+			}
+		}
+		if best != nil {
+			detection.Matches = append(detection.Matches, best)
+		}
+	}
+
+	sort.SliceStable(detection.Matches, func(i, j int) bool {
+		a, b := detection.Matches[i], detection.Matches[j]
+		if a.Registration.Priority != b.Registration.Priority {
+			return a.Registration.Priority > b.Registration.Priority
+		}
+		if a.Specificity != b.Specificity {
+			return a.Specificity > b.Specificity
+		}
+		return a.order > b.order
+	})
+
+	return detection, nil
+}
+
+// Find returns the registration of the provider, or nil when it is not
+// registered, like for external formatters declared in the configuration.
+func (me *Registry) Find(provider Provider) *Registration {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	for _, reg := range me.registrations {
+		if reg.Provider == provider {
+			return reg
+		}
+	}
+
+	return nil
+}
+
+// Names returns the names of all registered providers, sorted.
+func (me *Registry) Names() []string {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	names := make([]string, len(me.registrations))
+	for i, reg := range me.registrations {
+		names[i] = reg.Name
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// MatchTarget reports whether the doublestar target matches the slash
+// separated path. Targets without a slash only look at the base name.
+func MatchTarget(target string, path string) (bool, error) {
+	if !strings.Contains(target, "/") {
+		path = pathpkg.Base(path)
+	}
+
+	ok, err := doublestar.Match(strings.TrimPrefix(target, "/"), path)
+	if err != nil {
+		return false, errors.Errorf("failed to match glob %q: %w", target, err)
+	}
+	return ok, nil
+}
+
+func matchTargets(targets []string, filename string) (bool, error) {
+	path := filepath.ToSlash(filename)
+	for _, target := range targets {
+		ok, err := MatchTarget(target, path)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func targetSpecificity(target string) int {
+	specificity := 0
+	escaped := false
+	for _, r := range target {
+		switch {
+		case escaped:
+			escaped = false
+			specificity++
+		case r == '\\':
+			escaped = true
+		case strings.ContainsRune("*?[]{},", r):
+		default:
+			specificity++
+		}
+	}
+	return specificity
+}
@@ -0,0 +1,114 @@
+package format_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+type targetsProvider struct {
+	targets []string
+}
+
+func (me *targetsProvider) Targets() []string {
+	return me.targets
+}
+
+func (me *targetsProvider) Format(_ context.Context, _ format.Configuration, r io.Reader) (io.Reader, error) {
+	return r, nil
+}
+
+func TestRegistry(t *testing.T) {
+	yaml := &targetsProvider{[]string{"*.yaml", "*.yml"}}
+	special := &targetsProvider{[]string{"special.yaml"}}
+
+	reg := format.NewRegistry()
+	require.NoError(t, reg.Register(&format.Registration{Name: "yaml", Provider: yaml}))
+	require.NoError(t, reg.Register(&format.Registration{Name: "special", Provider: special, Priority: 10, Capabilities: format.CapabilityDiagnostics}))
+
+	assert.Error(t, reg.Register(&format.Registration{Name: "yaml", Provider: yaml}), "names should be unique")
+	assert.Error(t, reg.Register(&format.Registration{Name: "auto", Provider: yaml}), "auto is reserved")
+	assert.Error(t, reg.Register(&format.Registration{Name: "empty"}), "a provider is required")
+
+	assert.Equal(t, []string{"special", "yaml"}, reg.Names(), "names should be sorted")
+
+	found, err := reg.Lookup("yaml")
+	require.NoError(t, err, "registered names should be found")
+	assert.Same(t, yaml, found.Provider, "the provider should match")
+	assert.Equal(t, []string{"*.yaml", "*.yml"}, found.Targets, "targets should default to the provider's")
+
+	_, err = reg.Lookup("toml")
+	assert.Error(t, err, "unknown names should be reported")
+
+	tests := []struct {
+		filename string
+		expected format.Provider
+	}{
+		{filename: "dir/a.yml", expected: yaml},
+		{filename: "dir/special.yaml", expected: special},
+		{filename: "dir/a.toml", expected: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			found, err := reg.Detect(tt.filename)
+			require.NoError(t, err, "detecting should succeed")
+			if tt.expected == nil {
+				assert.Nil(t, found, "no provider should match")
+				return
+			}
+			require.NotNil(t, found, "a provider should match")
+			assert.Same(t, tt.expected, found.Provider, "the highest priority provider should win")
+		})
+	}
+
+	assert.True(t, reg.Find(special).Has(format.CapabilityDiagnostics), "capabilities should be kept")
+	assert.False(t, reg.Find(special).Has(format.CapabilityRange), "range needs a RangeProvider")
+	assert.Nil(t, reg.Find(&targetsProvider{}), "unregistered providers should not be found")
+}
+
+func TestRegistryExplain(t *testing.T) {
+	hcl := &targetsProvider{[]string{"*.hcl", "/.retab/*.retab"}}
+	deploy := &targetsProvider{[]string{"deploy/**/*.hcl"}}
+	modules := &targetsProvider{[]string{"modules/**/*.hcl"}}
+	other := &targetsProvider{[]string{"*.hcl"}}
+
+	reg := format.NewRegistry()
+	require.NoError(t, reg.Register(&format.Registration{Name: "hcl", Provider: hcl}))
+	require.NoError(t, reg.Register(&format.Registration{Name: "deploy", Provider: deploy}))
+	require.NoError(t, reg.Register(&format.Registration{Name: "modules", Provider: modules}))
+
+	tests := []struct {
+		path     string
+		expected string
+		matches  int
+	}{
+		{path: "main.hcl", expected: "hcl", matches: 1},
+		{path: "deploy/prod/main.hcl", expected: "deploy", matches: 2},
+		{path: "./modules/vpc/main.hcl", expected: "modules", matches: 2},
+		{path: "other/deploy/main.hcl", expected: "hcl", matches: 1},
+		{path: ".retab/settings.retab", expected: "hcl", matches: 1},
+		{path: "nested/.retab/settings.retab", expected: "", matches: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			detection, err := reg.Explain(tt.path)
+			require.NoError(t, err, "explaining should succeed")
+			assert.Len(t, detection.Matches, tt.matches, "every matching provider should be listed")
+			if tt.expected == "" {
+				assert.Nil(t, detection.Winner(), "no provider should match")
+				return
+			}
+			require.NotNil(t, detection.Winner(), "a provider should match")
+			assert.Equal(t, tt.expected, detection.Winner().Name, "the most specific target should win")
+		})
+	}
+
+	require.NoError(t, reg.Register(&format.Registration{Name: "other", Provider: other}))
+	found, err := reg.Detect("main.hcl")
+	require.NoError(t, err, "detecting should succeed")
+	assert.Equal(t, "other", found.Name, "the later registration should win a tie")
+}
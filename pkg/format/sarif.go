@@ -0,0 +1,219 @@
+package format
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// the subset of SARIF 2.1.0 retab writes, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+)
+
+// SARIF rule ids of the results retab reports.
+const (
+	SARIFRuleParse    = "parse-error"
+	SARIFRuleExternal = "external-formatter"
+	SARIFRuleError    = "error"
+	SARIFRuleFormat   = "unformatted"
+)
+
+var sarifRules = []*SARIFRule{
+	{ID: SARIFRuleParse, ShortDescription: &SARIFMessage{Text: "The file does not parse"}},
+	{ID: SARIFRuleExternal, ShortDescription: &SARIFMessage{Text: "The external formatter failed"}},
+	{ID: SARIFRuleError, ShortDescription: &SARIFMessage{Text: "The file could not be formatted"}},
+	{ID: SARIFRuleFormat, ShortDescription: &SARIFMessage{Text: "The file is not formatted"}},
+}
+
+type SARIFLog struct {
+	Schema  string      `json:"$schema"`
+	Version string      `json:"version"`
+	Runs    []*SARIFRun `json:"runs"`
+}
+
+type SARIFRun struct {
+	Tool    *SARIFTool     `json:"tool"`
+	Results []*SARIFResult `json:"results"`
+}
+
+type SARIFTool struct {
+	Driver *SARIFDriver `json:"driver"`
+}
+
+type SARIFDriver struct {
+	Name           string       `json:"name"`
+	InformationURI string       `json:"informationUri,omitempty"`
+	Rules          []*SARIFRule `json:"rules,omitempty"`
+}
+
+type SARIFRule struct {
+	ID               string        `json:"id"`
+	ShortDescription *SARIFMessage `json:"shortDescription,omitempty"`
+}
+
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+type SARIFResult struct {
+	RuleID    string           `json:"ruleId"`
+	Level     string           `json:"level"`
+	Message   *SARIFMessage    `json:"message"`
+	Locations []*SARIFLocation `json:"locations,omitempty"`
+	Fixes     []*SARIFFix      `json:"fixes,omitempty"`
+}
+
+type SARIFFix struct {
+	Description     *SARIFMessage          `json:"description,omitempty"`
+	ArtifactChanges []*SARIFArtifactChange `json:"artifactChanges"`
+}
+
+type SARIFArtifactChange struct {
+	ArtifactLocation *SARIFArtifactLocation `json:"artifactLocation"`
+	Replacements     []*SARIFReplacement    `json:"replacements"`
+}
+
+type SARIFReplacement struct {
+	DeletedRegion   *SARIFRegion          `json:"deletedRegion"`
+	InsertedContent *SARIFArtifactContent `json:"insertedContent,omitempty"`
+}
+
+type SARIFArtifactContent struct {
+	Text string `json:"text"`
+}
+
+type SARIFLocation struct {
+	PhysicalLocation *SARIFPhysicalLocation `json:"physicalLocation"`
+}
+
+type SARIFPhysicalLocation struct {
+	ArtifactLocation *SARIFArtifactLocation `json:"artifactLocation"`
+	Region           *SARIFRegion           `json:"region,omitempty"`
+}
+
+type SARIFArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type SARIFRegion struct {
+	StartLine   int `json:"startLine,omitempty"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// NewSARIFLog wraps the results in a log with a single run of retab.
+func NewSARIFLog(results []*SARIFResult) *SARIFLog {
+	return &SARIFLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []*SARIFRun{{
+			Tool: &SARIFTool{Driver: &SARIFDriver{
+				Name:           "retab",
+				InformationURI: "https://github.com/walteh/retab",
+				Rules:          sarifRules,
+			}},
+			Results: results,
+		}},
+	}
+}
+
+func (me *SARIFLog) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(me); err != nil {
+		return errors.Errorf("encoding sarif log: %w", err)
+	}
+	return nil
+}
+
+// DiagnosticsToSARIF turns every diagnostic into a result, parse errors of
+// the native parsers under SARIFRuleParse.
+func DiagnosticsToSARIF(diags []*Diagnostic) []*SARIFResult {
+	results := []*SARIFResult{}
+	for _, diag := range diags {
+		rule := SARIFRuleError
+		switch diag.Source {
+		case "":
+		case "hcl", "proto":
+			rule = SARIFRuleParse
+		default:
+			rule = SARIFRuleExternal
+		}
+
+		result := &SARIFResult{
+			RuleID:  rule,
+			Level:   string(diag.Severity),
+			Message: &SARIFMessage{Text: diag.Message},
+		}
+		if diag.File != "" {
+			location := &SARIFPhysicalLocation{ArtifactLocation: &SARIFArtifactLocation{URI: filepath.ToSlash(diag.File)}}
+			if diag.Line > 0 {
+				location.Region = &SARIFRegion{StartLine: diag.Line, StartColumn: diag.Column, EndLine: diag.EndLine, EndColumn: diag.EndColumn}
+			}
+			result.Locations = []*SARIFLocation{{PhysicalLocation: location}}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// UnformattedToSARIF returns a result for a file whose formatted content
+// differs, pointing at the first line that changes, with a fix replacing
+// every changed region. Columns count utf-16 code units, the SARIF default.
+func UnformattedToSARIF(filename string, original, formatted []byte) *SARIFResult {
+	edits := ComputeEdits(original, formatted)
+	lines := SplitLines(original)
+	artifact := &SARIFArtifactLocation{URI: filepath.ToSlash(filename)}
+
+	result := &SARIFResult{
+		RuleID:  SARIFRuleFormat,
+		Level:   "warning",
+		Message: &SARIFMessage{Text: "File is not formatted, run retab fmt"},
+		Locations: []*SARIFLocation{{PhysicalLocation: &SARIFPhysicalLocation{
+			ArtifactLocation: artifact,
+		}}},
+	}
+	if len(edits) == 0 {
+		return result
+	}
+
+	startLine, _ := sarifPosition(lines, edits[0].Start)
+	result.Locations[0].PhysicalLocation.Region = &SARIFRegion{StartLine: startLine}
+
+	change := &SARIFArtifactChange{ArtifactLocation: artifact, Replacements: []*SARIFReplacement{}}
+	for _, edit := range edits {
+		region := &SARIFRegion{}
+		region.StartLine, region.StartColumn = sarifPosition(lines, edit.Start)
+		region.EndLine, region.EndColumn = sarifPosition(lines, edit.End)
+		replacement := &SARIFReplacement{DeletedRegion: region}
+		if edit.NewText != "" {
+			replacement.InsertedContent = &SARIFArtifactContent{Text: edit.NewText}
+		}
+		change.Replacements = append(change.Replacements, replacement)
+	}
+	result.Fixes = []*SARIFFix{{
+		Description:     &SARIFMessage{Text: "Format the file"},
+		ArtifactChanges: []*SARIFArtifactChange{change},
+	}}
+
+	return result
+}
+
+// sarifPosition turns a zero-based position into a one-based line and
+// column. The end of content with a final newline is the start of a line
+// past the last one, which SARIF consumers reject, so positions there are
+// clamped to the end of the last line, after its newline.
+func sarifPosition(lines []string, pos Position) (int, int) {
+	if pos.Line < len(lines) || len(lines) == 0 {
+		return pos.Line + 1, pos.Column + 1
+	}
+
+	return len(lines), UTF16Len(lines[len(lines)-1]) + 1
+}
@@ -0,0 +1,149 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SniffSize is how much of the content is looked at to tell its language.
+const SniffSize = 8 << 10
+
+// modelineLines is how many lines at the start of the content may hold a
+// modeline.
+const modelineLines = 5
+
+// Sniffer is implemented by providers that can tell their language from the
+// content, for files whose name is inconclusive.
+type Sniffer interface {
+	// Sniff reports whether the content is in the provider's language,
+	// usually by parsing it. It should be cheap and strict, anything that
+	// does not parse cleanly is better left unformatted.
+	Sniff(head []byte) bool
+}
+
+var modelines = []*regexp.Regexp{
+	// # vim: ft=hcl, // vim: set filetype=proto :
+	regexp.MustCompile(`\b(?:vi|vim|ex):.*?\b(?:ft|filetype|syntax|syn)=([\w.+-]+)`),
+	// # -*- mode: hcl -*-, # -*- hcl -*-
+	regexp.MustCompile(`-\*-\s*(?:.*?\bmode:\s*)?([\w.+-]+)\s*(?:;.*)?-\*-`),
+	// // retab: proto
+	regexp.MustCompile(`\bretab:\s*([\w.+-]+)`),
+}
+
+// Sniff picks the provider for content whose file name is inconclusive. It
+// looks for a modeline like "# vim: ft=hcl" or "// retab: proto" in the first
+// lines, then for a shebang, and finally asks the providers implementing
+// Sniffer, in the order of Explain. Modelines and shebangs are matched
+// against the names and aliases of the providers. Content longer than
+// SniffSize is cut after its last line starting with a closing brace, which
+// ends a top-level block in most languages, or else after its last full line.
+// It returns nil when nothing matches.
+func (me *Registry) Sniff(content []byte) *Registration {
+	head := sniffHead(content)
+
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	scanner := bufio.NewScanner(bytes.NewReader(head))
+	for i := 0; i < modelineLines && scanner.Scan(); i++ {
+		line := scanner.Text()
+
+		if i == 0 && strings.HasPrefix(line, "#!") {
+			if reg := me.byName(shebangInterpreter(line)); reg != nil {
+				return reg
+			}
+			continue
+		}
+
+		for _, modeline := range modelines {
+			if m := modeline.FindStringSubmatch(line); m != nil {
+				if reg := me.byName(m[1]); reg != nil {
+					return reg
+				}
+			}
+		}
+	}
+
+	sniffers := []*Registration{}
+	order := map[*Registration]int{}
+	for i, reg := range me.registrations {
+		if _, ok := reg.Provider.(Sniffer); ok {
+			sniffers = append(sniffers, reg)
+			order[reg] = i
+		}
+	}
+	sort.SliceStable(sniffers, func(i, j int) bool {
+		if sniffers[i].Priority != sniffers[j].Priority {
+			return sniffers[i].Priority > sniffers[j].Priority
+		}
+		return order[sniffers[i]] > order[sniffers[j]]
+	})
+
+	for _, reg := range sniffers {
+		if reg.Provider.(Sniffer).Sniff(head) {
+			return reg
+		}
+	}
+
+	return nil
+}
+
+// byName returns the registration with the name or alias, ignoring case.
+func (me *Registry) byName(name string) *Registration {
+	if name == "" {
+		return nil
+	}
+	for _, reg := range me.registrations {
+		if strings.EqualFold(reg.Name, name) {
+			return reg
+		}
+		for _, alias := range reg.Aliases {
+			if strings.EqualFold(alias, name) {
+				return reg
+			}
+		}
+	}
+	return nil
+}
+
+// shebangInterpreter returns the name of the interpreter of a shebang line,
+// looking through env, like "dart" for "#!/usr/bin/env dart".
+func shebangInterpreter(line string) string {
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := filepath.Base(fields[0])
+	if interpreter != "env" {
+		return interpreter
+	}
+
+	for _, field := range fields[1:] {
+		if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+			return filepath.Base(field)
+		}
+	}
+	return ""
+}
+
+func sniffHead(content []byte) []byte {
+	if len(content) <= SniffSize {
+		return content
+	}
+
+	head := content[:SniffSize]
+	if i := bytes.LastIndex(head, []byte("\n}")); i >= 0 {
+		if end := bytes.IndexByte(head[i+1:], '\n'); end >= 0 {
+			return head[:i+1+end+1]
+		}
+	}
+	if i := bytes.LastIndexByte(head, '\n'); i >= 0 {
+		return head[:i+1]
+	}
+	return head
+}
@@ -0,0 +1,79 @@
+package format_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+type sniffingProvider struct {
+	targetsProvider
+	prefix string
+}
+
+func (me *sniffingProvider) Sniff(head []byte) bool {
+	return strings.HasPrefix(string(head), me.prefix)
+}
+
+func TestRegistrySniff(t *testing.T) {
+	reg := format.NewRegistry()
+	require.NoError(t, reg.Register(&format.Registration{Name: "hcl", Aliases: []string{"nomad"}, Provider: &sniffingProvider{prefix: "job"}}))
+	require.NoError(t, reg.Register(&format.Registration{Name: "proto", Aliases: []string{"protobuf"}, Provider: &sniffingProvider{prefix: "syntax"}}))
+	require.NoError(t, reg.Register(&format.Registration{Name: "dart", Provider: &targetsProvider{[]string{"*.dart"}}}))
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{name: "vim_modeline", content: "# vim: ft=hcl\na = 1\n", expected: "hcl"},
+		{name: "vim_set_modeline", content: "// vim: set ts=4 filetype=protobuf :\n", expected: "proto"},
+		{name: "emacs_modeline", content: "# -*- mode: nomad -*-\n", expected: "hcl"},
+		{name: "retab_modeline", content: "// retab: proto\nmessage A {}\n", expected: "proto"},
+		{name: "shebang", content: "#!/usr/bin/env dart\nvoid main() {}\n", expected: "dart"},
+		{name: "shebang_path", content: "#!/opt/bin/dart\n", expected: "dart"},
+		{name: "unknown_modeline_falls_back", content: "syntax = \"proto3\";\n// vim: ft=cobol\n", expected: "proto"},
+		{name: "sniffer", content: "job \"web\" {}\n", expected: "hcl"},
+		{name: "inconclusive", content: "hello world\n", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := reg.Sniff([]byte(tt.content))
+			if tt.expected == "" {
+				assert.Nil(t, found, "nothing should match")
+				return
+			}
+			require.NotNil(t, found, "a provider should match")
+			assert.Equal(t, tt.expected, found.Name, "the provider should match")
+		})
+	}
+}
+
+func TestRegistrySniffCutsLongContent(t *testing.T) {
+	var seen []byte
+	provider := &sniffingProvider{}
+
+	reg := format.NewRegistry()
+	require.NoError(t, reg.Register(&format.Registration{Name: "probe", Provider: &recordingSniffer{provider, &seen}}))
+
+	block := "block {\n\ta = 1\n}\n"
+	content := strings.Repeat(block, format.SniffSize/len(block)+10)
+	reg.Sniff([]byte(content))
+
+	assert.LessOrEqual(t, len(seen), format.SniffSize, "only the head should be sniffed")
+	assert.True(t, strings.HasSuffix(string(seen), "}\n"), "the head should end after a closing brace")
+}
+
+type recordingSniffer struct {
+	*sniffingProvider
+	seen *[]byte
+}
+
+func (me *recordingSniffer) Sniff(head []byte) bool {
+	*me.seen = head
+	return false
+}
@@ -0,0 +1,156 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Repository runs git plumbing commands against a local repository.
+type Repository struct {
+	root string
+	// dir is the directory the repository was opened from, which pathspecs
+	// are relative to.
+	dir string
+}
+
+// StagedFile is a regular file with changes in the git index.
+type StagedFile struct {
+	// Path is relative to the repository root, using forward slashes.
+	Path string
+	// Mode is the git file mode of the staged entry, e.g. 100644.
+	Mode string
+}
+
+// Open finds the repository containing dir. Pathspecs given to the
+// repository are relative to dir, like on the git command line.
+func Open(ctx context.Context, dir string) (*Repository, error) {
+	out, err := run(ctx, dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, errors.Errorf("finding repository root: %w", err)
+	}
+
+	return &Repository{root: strings.TrimSpace(string(out)), dir: dir}, nil
+}
+
+// Root returns the absolute path of the working tree.
+func (me *Repository) Root() string {
+	return me.root
+}
+
+// Abs returns the absolute working tree path of a repository path.
+func (me *Repository) Abs(path string) string {
+	return filepath.Join(me.root, filepath.FromSlash(path))
+}
+
+// StagedFiles returns the added, copied, modified and renamed regular files in
+// the index, optionally limited to the given pathspecs, which are relative to
+// the directory the repository was opened from.
+func (me *Repository) StagedFiles(ctx context.Context, pathspecs ...string) ([]*StagedFile, error) {
+	// run from dir so git resolves the pathspecs, --no-relative keeps the
+	// listed paths relative to the root whatever diff.relative says
+	args := append([]string{"diff", "--cached", "--no-relative", "--name-only", "--diff-filter=ACMR", "-z", "--"}, pathspecs...)
+	out, err := run(ctx, me.dir, nil, args...)
+	if err != nil {
+		return nil, errors.Errorf("listing staged files: %w", err)
+	}
+
+	files := []*StagedFile{}
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path == "" {
+			continue
+		}
+
+		mode, err := me.stagedMode(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+
+		// symlinks (120000) and submodules (160000) have nothing to format
+		if mode != "100644" && mode != "100755" {
+			zerolog.Ctx(ctx).Debug().Str("path", path).Str("mode", mode).Msg("skipping staged entry that is not a regular file")
+			continue
+		}
+
+		files = append(files, &StagedFile{Path: path, Mode: mode})
+	}
+
+	return files, nil
+}
+
+func (me *Repository) stagedMode(ctx context.Context, path string) (string, error) {
+	out, err := run(ctx, me.root, nil, "ls-files", "--stage", "-z", "--", path)
+	if err != nil {
+		return "", errors.Errorf("reading index entry for '%s': %w", path, err)
+	}
+
+	// <mode> SP <object> SP <stage> TAB <path>
+	fields := strings.Fields(string(out))
+	if len(fields) < 1 {
+		return "", errors.Errorf("no index entry for '%s'", path)
+	}
+
+	return fields[0], nil
+}
+
+// ReadStaged returns the content of the file as it is in the index.
+func (me *Repository) ReadStaged(ctx context.Context, file *StagedFile) ([]byte, error) {
+	out, err := run(ctx, me.root, nil, "cat-file", "blob", ":"+file.Path)
+	if err != nil {
+		return nil, errors.Errorf("reading staged content of '%s': %w", file.Path, err)
+	}
+
+	return out, nil
+}
+
+// WriteStaged replaces the content of the file in the index, without touching
+// the working tree. The content is stored as is, since it comes from the index
+// and has already been through the clean filters and eol conversion.
+func (me *Repository) WriteStaged(ctx context.Context, file *StagedFile, content []byte) error {
+	out, err := run(ctx, me.root, content, "hash-object", "-w", "--stdin", "--no-filters")
+	if err != nil {
+		return errors.Errorf("writing object for '%s': %w", file.Path, err)
+	}
+
+	cacheinfo := file.Mode + "," + strings.TrimSpace(string(out)) + "," + file.Path
+	if _, err := run(ctx, me.root, nil, "update-index", "--cacheinfo", cacheinfo); err != nil {
+		return errors.Errorf("updating index for '%s': %w", file.Path, err)
+	}
+
+	return nil
+}
+
+// ApplyToWorktree applies a unified diff to the working tree only. It fails
+// without changing anything if the patch does not apply cleanly.
+func (me *Repository) ApplyToWorktree(ctx context.Context, patch string) error {
+	if _, err := run(ctx, me.root, []byte(patch), "apply", "--whitespace=nowarn", "-"); err != nil {
+		return errors.Errorf("applying patch to working tree: %w", err)
+	}
+
+	return nil
+}
+
+func run(ctx context.Context, dir string, stdin []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	zerolog.Ctx(ctx).Debug().Strs("args", args).Msg("running git")
+
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Errorf("running git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,122 @@
+package git_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/git"
+	"github.com/walteh/retab/v2/pkg/git/gittest"
+)
+
+func paths(files []*git.StagedFile) []string {
+	out := []string{}
+	for _, file := range files {
+		out = append(out, file.Path)
+	}
+	return out
+}
+
+func TestStagedFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := gittest.NewRepo(t, map[string]string{
+		"x.hcl":     "a = 1\n",
+		"sub/x.hcl": "b = 2\n",
+		"sub/y.hcl": "c = 3\n",
+	})
+	require.NoError(t, os.Symlink("x.hcl", filepath.Join(dir, "link.hcl")))
+	gittest.Run(t, dir, "add", "link.hcl")
+
+	repo, err := git.Open(ctx, dir)
+	require.NoError(t, err)
+
+	files, err := repo.StagedFiles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sub/x.hcl", "sub/y.hcl", "x.hcl"}, paths(files), "symlinks should be skipped")
+	assert.Equal(t, "100644", files[0].Mode, "mode should match")
+
+	t.Run("pathspecs are relative to the directory", func(t *testing.T) {
+		repo, err := git.Open(ctx, filepath.Join(dir, "sub"))
+		require.NoError(t, err)
+
+		root, err := filepath.EvalSymlinks(dir)
+		require.NoError(t, err)
+		assert.Equal(t, root, repo.Root(), "the root should be the top of the repository")
+
+		files, err := repo.StagedFiles(ctx, "x.hcl")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sub/x.hcl"}, paths(files), "paths should be relative to the root")
+
+		files, err = repo.StagedFiles(ctx, ".")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sub/x.hcl", "sub/y.hcl"}, paths(files), "only the directory should be listed")
+	})
+}
+
+func TestWriteStaged(t *testing.T) {
+	ctx := context.Background()
+	dir := gittest.NewRepo(t, map[string]string{"sub/x.hcl": "a=1\n"})
+
+	repo, err := git.Open(ctx, dir)
+	require.NoError(t, err)
+
+	files, err := repo.StagedFiles(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	content, err := repo.ReadStaged(ctx, files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "a=1\n", string(content), "staged content should match")
+
+	require.NoError(t, repo.WriteStaged(ctx, files[0], []byte("a = 1\n")))
+
+	content, err = repo.ReadStaged(ctx, files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "a = 1\n", string(content), "the index should be updated")
+
+	worktree, err := os.ReadFile(filepath.Join(dir, "sub", "x.hcl"))
+	require.NoError(t, err)
+	assert.Equal(t, "a=1\n", string(worktree), "the working tree should be untouched")
+}
+
+func TestWriteStagedSkipsFilters(t *testing.T) {
+	ctx := context.Background()
+	dir := gittest.NewRepo(t, map[string]string{"x.hcl": "a=1\n"})
+	gittest.WriteFile(t, filepath.Join(dir, ".gitattributes"), "*.hcl filter=upper\n")
+	gittest.Run(t, dir, "config", "filter.upper.clean", "tr a-z A-Z")
+
+	repo, err := git.Open(ctx, dir)
+	require.NoError(t, err)
+
+	files, err := repo.StagedFiles(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	require.NoError(t, repo.WriteStaged(ctx, files[0], []byte("a = 1\n")))
+
+	content, err := repo.ReadStaged(ctx, files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "a = 1\n", string(content), "clean filters should not run on content from the index")
+}
+
+func TestApplyToWorktree(t *testing.T) {
+	ctx := context.Background()
+	dir := gittest.NewRepo(t, map[string]string{"x.hcl": "a=1\n"})
+
+	repo, err := git.Open(ctx, dir)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.ApplyToWorktree(ctx, "--- a/x.hcl\n+++ b/x.hcl\n@@ -1 +1 @@\n-a=1\n+a = 1\n"))
+
+	worktree, err := os.ReadFile(filepath.Join(dir, "x.hcl"))
+	require.NoError(t, err)
+	assert.Equal(t, "a = 1\n", string(worktree), "the patch should be applied")
+
+	assert.Error(t, repo.ApplyToWorktree(ctx, "--- a/x.hcl\n+++ b/x.hcl\n@@ -1 +1 @@\n-b=2\n+b = 2\n"), "patches that do not apply should fail")
+	worktree, err = os.ReadFile(filepath.Join(dir, "x.hcl"))
+	require.NoError(t, err)
+	assert.Equal(t, "a = 1\n", string(worktree), "a failed patch should change nothing")
+}
@@ -0,0 +1,47 @@
+// Package gittest creates git repositories in temporary directories for tests.
+package gittest
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// NewRepo creates a repository in a temporary directory with the files
+// written and staged.
+func NewRepo(t testing.TB, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	Run(t, dir, "init", "-q")
+	Run(t, dir, "config", "user.email", "test@example.com")
+	Run(t, dir, "config", "user.name", "test")
+
+	for filename, content := range files {
+		WriteFile(t, filepath.Join(dir, filename), content)
+		Run(t, dir, "add", filename)
+	}
+
+	return dir
+}
+
+// Run runs git in dir and returns its combined output, failing the test if
+// it fails.
+func Run(t testing.TB, dir string, args ...string) string {
+	t.Helper()
+
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	require.NoError(t, err, "git %v: %s", args, out)
+	return string(out)
+}
+
+// WriteFile writes the file, creating its directory if needed.
+func WriteFile(t testing.TB, filename, content string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+}
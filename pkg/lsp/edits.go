@@ -0,0 +1,21 @@
+package lsp
+
+import (
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+// toTextEdits converts the edits returned by the format package into the
+// protocol representation.
+func toTextEdits(edits []*format.TextEdit) []*TextEdit {
+	res := make([]*TextEdit, 0, len(edits))
+	for _, edit := range edits {
+		res = append(res, &TextEdit{
+			Range: Range{
+				Start: Position{Line: edit.Start.Line, Character: edit.Start.Column},
+				End:   Position{Line: edit.End.Line, Character: edit.End.Column},
+			},
+			NewText: edit.NewText,
+		})
+	}
+	return res
+}
@@ -0,0 +1,132 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// json-rpc error codes used by the server
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeRequestFailed  = -32803
+	// codeRequestCancelled answers requests cancelled with $/cancelRequest
+	codeRequestCancelled = -32800
+)
+
+type request struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+func (me *request) isNotification() bool {
+	return me.ID == nil
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  any              `json:"result"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (me *responseError) Error() string {
+	return me.Message
+}
+
+// conn reads and writes json-rpc messages framed with Content-Length headers.
+type conn struct {
+	reader *textproto.Reader
+	writer io.Writer
+	mu     sync.Mutex
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{
+		reader: textproto.NewReader(bufio.NewReader(r)),
+		writer: w,
+	}
+}
+
+func (me *conn) read() (*request, error) {
+	header, err := me.reader.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil {
+		return nil, errors.Errorf("parsing content length: %w", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(me.reader.R, body); err != nil {
+		return nil, errors.Errorf("reading message body: %w", err)
+	}
+
+	req := &request{}
+	if err := json.Unmarshal(body, req); err != nil {
+		return nil, &responseError{Code: codeParseError, Message: err.Error()}
+	}
+
+	return req, nil
+}
+
+func (me *conn) write(msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Errorf("encoding message: %w", err)
+	}
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if _, err := io.WriteString(me.writer, "Content-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"); err != nil {
+		return errors.Errorf("writing message header: %w", err)
+	}
+
+	if _, err := me.writer.Write(body); err != nil {
+		return errors.Errorf("writing message body: %w", err)
+	}
+
+	return nil
+}
+
+func (me *conn) reply(id *json.RawMessage, result any, rerr error) error {
+	resp := &response{JSONRPC: "2.0", ID: id, Result: result}
+	if rerr != nil {
+		resp.Result = nil
+		var re *responseError
+		if !errors.As(rerr, &re) {
+			re = &responseError{Code: codeRequestFailed, Message: rerr.Error()}
+		}
+		resp.Error = re
+	}
+
+	return me.write(resp)
+}
+
+func (me *conn) notify(method string, params any) error {
+	return me.write(&notification{JSONRPC: "2.0", Method: method, Params: params})
+}
@@ -0,0 +1,160 @@
+package lsp
+
+import "encoding/json"
+
+// This file holds the subset of the language server protocol types used by
+// the server. Field names follow the specification.
+
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type TextDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type WorkspaceFolder struct {
+	URI  string `json:"uri"`
+	Name string `json:"name"`
+}
+
+type CancelParams struct {
+	// ID is the number or string id of the request to cancel.
+	ID json.RawMessage `json:"id"`
+}
+
+type InitializeParams struct {
+	RootURI          string             `json:"rootUri"`
+	WorkspaceFolders []*WorkspaceFolder `json:"workspaceFolders"`
+}
+
+type InitializeResult struct {
+	Capabilities *ServerCapabilities `json:"capabilities"`
+	ServerInfo   *ServerInfo         `json:"serverInfo,omitempty"`
+}
+
+type ServerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type ServerCapabilities struct {
+	TextDocumentSync                 *TextDocumentSyncOptions         `json:"textDocumentSync"`
+	DocumentFormattingProvider       bool                             `json:"documentFormattingProvider"`
+	DocumentRangeFormattingProvider  bool                             `json:"documentRangeFormattingProvider"`
+	DocumentOnTypeFormattingProvider *DocumentOnTypeFormattingOptions `json:"documentOnTypeFormattingProvider,omitempty"`
+	Workspace                        *WorkspaceCapabilities           `json:"workspace,omitempty"`
+}
+
+const textDocumentSyncKindFull = 1
+
+type TextDocumentSyncOptions struct {
+	OpenClose bool `json:"openClose"`
+	Change    int  `json:"change"`
+	Save      bool `json:"save"`
+}
+
+type DocumentOnTypeFormattingOptions struct {
+	FirstTriggerCharacter string   `json:"firstTriggerCharacter"`
+	MoreTriggerCharacter  []string `json:"moreTriggerCharacter,omitempty"`
+}
+
+type WorkspaceCapabilities struct {
+	WorkspaceFolders *WorkspaceFoldersServerCapabilities `json:"workspaceFolders,omitempty"`
+}
+
+type WorkspaceFoldersServerCapabilities struct {
+	Supported           bool `json:"supported"`
+	ChangeNotifications bool `json:"changeNotifications"`
+}
+
+type DidOpenTextDocumentParams struct {
+	TextDocument *TextDocumentItem `json:"textDocument"`
+}
+
+type DidChangeTextDocumentParams struct {
+	TextDocument   *TextDocumentIdentifier           `json:"textDocument"`
+	ContentChanges []*TextDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+type TextDocumentContentChangeEvent struct {
+	Text string `json:"text"`
+}
+
+type DidCloseTextDocumentParams struct {
+	TextDocument *TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DidSaveTextDocumentParams struct {
+	TextDocument *TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DidChangeWatchedFilesParams struct {
+	Changes []*FileEvent `json:"changes"`
+}
+
+type FileEvent struct {
+	URI  string `json:"uri"`
+	Type int    `json:"type"`
+}
+
+type DidChangeWorkspaceFoldersParams struct {
+	Event *WorkspaceFoldersChangeEvent `json:"event"`
+}
+
+type WorkspaceFoldersChangeEvent struct {
+	Added   []*WorkspaceFolder `json:"added"`
+	Removed []*WorkspaceFolder `json:"removed"`
+}
+
+type DocumentFormattingParams struct {
+	TextDocument *TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DocumentRangeFormattingParams struct {
+	TextDocument *TextDocumentIdentifier `json:"textDocument"`
+	Range        Range                   `json:"range"`
+}
+
+type DocumentOnTypeFormattingParams struct {
+	TextDocument *TextDocumentIdentifier `json:"textDocument"`
+	Position     Position                `json:"position"`
+	Ch           string                  `json:"ch"`
+}
+
+type DiagnosticSeverity int
+
+const (
+	SeverityError   DiagnosticSeverity = 1
+	SeverityWarning DiagnosticSeverity = 2
+)
+
+type Diagnostic struct {
+	Range    Range              `json:"range"`
+	Severity DiagnosticSeverity `json:"severity"`
+	Source   string             `json:"source"`
+	Message  string             `json:"message"`
+}
+
+type PublishDiagnosticsParams struct {
+	URI         string        `json:"uri"`
+	Diagnostics []*Diagnostic `json:"diagnostics"`
+}
@@ -0,0 +1,555 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/retab/v2/pkg/autoformat"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/format/cmdfmt"
+	"github.com/walteh/retab/v2/pkg/format/editorconfig"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Server is a language server that speaks json-rpc over a reader and writer
+// pair, usually stdin and stdout.
+type Server struct {
+	conn    *conn
+	version string
+
+	mu        sync.Mutex
+	documents map[string]string
+	folders   []string
+	// configs caches the editorconfig resolution per workspace folder
+	configs map[string]*editorconfig.EditorConfigConfigurationProvider
+
+	shutdown bool
+
+	// pending cancels the requests being handled, by their json-rpc id
+	pending  map[string]context.CancelFunc
+	inflight sync.WaitGroup
+}
+
+// ExitWithoutShutdownError is returned by Run when the client sends "exit"
+// without a "shutdown" request first, which the protocol treats as an
+// abnormal exit.
+type ExitWithoutShutdownError struct{}
+
+func (me *ExitWithoutShutdownError) Error() string {
+	return "client sent exit without shutdown"
+}
+
+func NewServer(version string) *Server {
+	return &Server{
+		version:   version,
+		documents: map[string]string{},
+		configs:   map[string]*editorconfig.EditorConfigConfigurationProvider{},
+		pending:   map[string]context.CancelFunc{},
+	}
+}
+
+// Run serves requests until the client sends "exit" or closes the connection.
+// It returns an *ExitWithoutShutdownError if "exit" came before "shutdown".
+// Notifications are handled in order, since they change the documents the
+// requests work on. Requests run concurrently, so a slow external formatter
+// does not hold up the others, and can be cancelled with $/cancelRequest.
+func (me *Server) Run(ctx context.Context, r io.Reader, w io.Writer) error {
+	me.conn = newConn(r, w)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		// requests still running are abandoned without a reply
+		cancel()
+		me.inflight.Wait()
+	}()
+
+	for {
+		req, err := me.conn.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			var re *responseError
+			if errors.As(err, &re) {
+				zerolog.Ctx(ctx).Warn().Err(err).Msg("invalid message")
+				continue
+			}
+			return errors.Errorf("reading message: %w", err)
+		}
+
+		if req.Method == "exit" {
+			me.mu.Lock()
+			shutdown := me.shutdown
+			me.mu.Unlock()
+
+			if !shutdown {
+				return &ExitWithoutShutdownError{}
+			}
+			return nil
+		}
+
+		if req.Method == "$/cancelRequest" {
+			params := &CancelParams{}
+			if err := decodeParams(req, params); err != nil {
+				zerolog.Ctx(ctx).Warn().Err(err).Str("method", req.Method).Msg("handling notification")
+				continue
+			}
+			me.cancelRequest(params.ID)
+			continue
+		}
+
+		if req.isNotification() {
+			if _, err := me.handle(ctx, req); err != nil {
+				zerolog.Ctx(ctx).Warn().Err(err).Str("method", req.Method).Msg("handling notification")
+			}
+			continue
+		}
+
+		// registered before the request starts, so a cancellation read right
+		// after it is not lost
+		reqCtx, cancelReq := context.WithCancel(ctx)
+		me.mu.Lock()
+		me.pending[string(*req.ID)] = cancelReq
+		me.mu.Unlock()
+
+		me.inflight.Add(1)
+		go me.serve(ctx, reqCtx, req)
+	}
+}
+
+// serve handles the request and replies to it, unless the server is exiting.
+func (me *Server) serve(ctx, reqCtx context.Context, req *request) {
+	defer me.inflight.Done()
+
+	result, err := me.handle(reqCtx, req)
+	if reqCtx.Err() != nil {
+		result, err = nil, &responseError{Code: codeRequestCancelled, Message: "request cancelled"}
+	}
+
+	me.mu.Lock()
+	if cancel, ok := me.pending[string(*req.ID)]; ok {
+		cancel()
+		delete(me.pending, string(*req.ID))
+	}
+	me.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err := me.conn.reply(req.ID, result, err); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Str("method", req.Method).Msg("replying to request")
+	}
+}
+
+// cancelRequest cancels the context of a request that is still running.
+// Requests that already finished are ignored.
+func (me *Server) cancelRequest(id json.RawMessage) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if cancel, ok := me.pending[string(id)]; ok {
+		cancel()
+	}
+}
+
+func (me *Server) handle(ctx context.Context, req *request) (any, error) {
+	ctx = zerolog.Ctx(ctx).With().Str("method", req.Method).Logger().WithContext(ctx)
+
+	me.mu.Lock()
+	shutdown := me.shutdown
+	me.mu.Unlock()
+
+	if shutdown && !req.isNotification() {
+		return nil, &responseError{Code: codeRequestFailed, Message: "server is shutting down"}
+	}
+
+	switch req.Method {
+	case "initialize":
+		params := &InitializeParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		return me.initialize(ctx, params)
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		me.mu.Lock()
+		me.shutdown = true
+		me.mu.Unlock()
+		return nil, nil
+	case "textDocument/didOpen":
+		params := &DidOpenTextDocumentParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		me.setDocument(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, me.publishDiagnostics(ctx, params.TextDocument.URI)
+	case "textDocument/didChange":
+		params := &DidChangeTextDocumentParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		// the server only asks for full document sync, so the last change
+		// holds the whole document
+		if len(params.ContentChanges) > 0 {
+			me.setDocument(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+		return nil, me.publishDiagnostics(ctx, params.TextDocument.URI)
+	case "textDocument/didSave":
+		params := &DidSaveTextDocumentParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		if invalidatesConfigs(uriToPath(params.TextDocument.URI)) {
+			me.invalidateConfigs()
+		}
+		return nil, me.publishDiagnostics(ctx, params.TextDocument.URI)
+	case "textDocument/didClose":
+		params := &DidCloseTextDocumentParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		me.mu.Lock()
+		delete(me.documents, params.TextDocument.URI)
+		me.mu.Unlock()
+		return nil, me.conn.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []*Diagnostic{}})
+	case "workspace/didChangeWatchedFiles":
+		params := &DidChangeWatchedFilesParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		for _, change := range params.Changes {
+			if invalidatesConfigs(uriToPath(change.URI)) {
+				me.invalidateConfigs()
+				break
+			}
+		}
+		return nil, nil
+	case "workspace/didChangeWorkspaceFolders":
+		params := &DidChangeWorkspaceFoldersParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		me.changeFolders(params.Event)
+		return nil, nil
+	case "textDocument/formatting":
+		params := &DocumentFormattingParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		return me.formatting(ctx, params.TextDocument.URI, nil)
+	case "textDocument/rangeFormatting":
+		params := &DocumentRangeFormattingParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		end := params.Range.End.Line
+		if params.Range.End.Character == 0 && end > params.Range.Start.Line {
+			// a selection ending at the start of a line does not include it
+			end--
+		}
+		return me.formatting(ctx, params.TextDocument.URI, &format.LineRange{Start: params.Range.Start.Line, End: end})
+	case "textDocument/onTypeFormatting":
+		params := &DocumentOnTypeFormattingParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		limit := &format.LineRange{Start: params.Position.Line, End: params.Position.Line}
+		if params.Ch == "\n" && limit.Start > 0 {
+			// the line that was just finished is the one worth formatting
+			limit.Start--
+		}
+		return me.formatting(ctx, params.TextDocument.URI, limit)
+	default:
+		if req.isNotification() {
+			return nil, nil
+		}
+		return nil, &responseError{Code: codeMethodNotFound, Message: "method not supported: " + req.Method}
+	}
+}
+
+func decodeParams(req *request, params any) error {
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (me *Server) initialize(_ context.Context, params *InitializeParams) (*InitializeResult, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	for _, folder := range params.WorkspaceFolders {
+		me.folders = append(me.folders, uriToPath(folder.URI))
+	}
+	if len(me.folders) == 0 && params.RootURI != "" {
+		me.folders = append(me.folders, uriToPath(params.RootURI))
+	}
+
+	return &InitializeResult{
+		Capabilities: &ServerCapabilities{
+			TextDocumentSync: &TextDocumentSyncOptions{
+				OpenClose: true,
+				Change:    textDocumentSyncKindFull,
+				Save:      true,
+			},
+			DocumentFormattingProvider:      true,
+			DocumentRangeFormattingProvider: true,
+			DocumentOnTypeFormattingProvider: &DocumentOnTypeFormattingOptions{
+				FirstTriggerCharacter: "}",
+				MoreTriggerCharacter:  []string{"]", ";", "\n"},
+			},
+			Workspace: &WorkspaceCapabilities{
+				WorkspaceFolders: &WorkspaceFoldersServerCapabilities{
+					Supported:           true,
+					ChangeNotifications: true,
+				},
+			},
+		},
+		ServerInfo: &ServerInfo{Name: "retab", Version: me.version},
+	}, nil
+}
+
+func (me *Server) changeFolders(event *WorkspaceFoldersChangeEvent) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	for _, removed := range event.Removed {
+		path := uriToPath(removed.URI)
+		delete(me.configs, path)
+		for i, folder := range me.folders {
+			if folder == path {
+				me.folders = append(me.folders[:i], me.folders[i+1:]...)
+				break
+			}
+		}
+	}
+
+	for _, added := range event.Added {
+		me.folders = append(me.folders, uriToPath(added.URI))
+	}
+}
+
+func (me *Server) setDocument(uri, text string) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	me.documents[uri] = text
+}
+
+func (me *Server) document(uri string) (string, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	text, ok := me.documents[uri]
+	if !ok {
+		return "", &responseError{Code: codeInvalidParams, Message: "document is not open: " + uri}
+	}
+
+	return text, nil
+}
+
+// configFor returns the cached editorconfig provider of the workspace folder
+// that contains the file. Files outside of any folder share one provider.
+func (me *Server) configFor(ctx context.Context, filename string) format.ConfigurationProvider {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	folder := ""
+	for _, candidate := range me.folders {
+		if len(candidate) > len(folder) && (filename == candidate || strings.HasPrefix(filename, candidate+string(filepath.Separator))) {
+			folder = candidate
+		}
+	}
+
+	cfg, ok := me.configs[folder]
+	if !ok {
+		cfg = editorconfig.NewCachedConfigurationProvider(ctx)
+		me.configs[folder] = cfg
+	}
+
+	return cfg
+}
+
+// invalidatesConfigs reports whether a change to the file can change the
+// configuration or the project root of other files.
+func invalidatesConfigs(filename string) bool {
+	return filepath.Base(filename) == ".editorconfig" || autoformat.IsProjectMarker(filename)
+}
+
+func (me *Server) invalidateConfigs() {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	for _, cfg := range me.configs {
+		cfg.Invalidate()
+	}
+	autoformat.InvalidateProjectRoots()
+}
+
+// formatting formats the document and returns the edits, limited to the
+// given lines if set. Documents without a formatter get no edits.
+func (me *Server) formatting(ctx context.Context, uri string, limit *format.LineRange) ([]*TextEdit, error) {
+	text, err := me.document(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := uriToPath(uri)
+
+	fmtr, err := autoformat.ResolveFormatter(ctx, me.configFor(ctx, filename), "auto", filename)
+	if err != nil {
+		return nil, errors.Errorf("resolving formatter: %w", err)
+	}
+	if fmtr == nil {
+		fmtr = autoformat.SniffFormatter([]byte(text))
+	}
+	if fmtr == nil {
+		return []*TextEdit{}, nil
+	}
+
+	if limit != nil {
+		edits, err := format.FormatRange(ctx, fmtr, me.configFor(ctx, filename), filename, []byte(text), *limit)
+		if err != nil {
+			return nil, formattingError(filename, errors.Errorf("formatting range of %s: %w", filename, err))
+		}
+		return toTextEdits(edits), nil
+	}
+
+	r, err := format.Format(ctx, fmtr, me.configFor(ctx, filename), filename, strings.NewReader(text))
+	if err != nil {
+		return nil, formattingError(filename, errors.Errorf("formatting %s: %w", filename, err))
+	}
+
+	formatted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Errorf("reading formatted content: %w", err)
+	}
+
+	return toTextEdits(format.ComputeEdits([]byte(text), formatted)), nil
+}
+
+// formattingError replaces the wrapped error chain of an external formatter
+// that timed out with a message the editor can show as is.
+func formattingError(filename string, err error) error {
+	var timeout *cmdfmt.TimeoutError
+	if errors.As(err, &timeout) {
+		return &responseError{Code: codeRequestFailed, Message: fmt.Sprintf("formatting %s: %s", filepath.Base(filename), timeout)}
+	}
+	return err
+}
+
+func (me *Server) publishDiagnostics(ctx context.Context, uri string) error {
+	diags, err := me.diagnose(ctx, uri)
+	if err != nil {
+		return err
+	}
+
+	return me.conn.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{URI: uri, Diagnostics: diags})
+}
+
+// diagnose runs the native parsers over the document. External formatters
+// are skipped, since starting a process on every keystroke is too slow.
+func (me *Server) diagnose(ctx context.Context, uri string) ([]*Diagnostic, error) {
+	text, err := me.document(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := uriToPath(uri)
+
+	fmtr, err := autoformat.ResolveFormatter(ctx, me.configFor(ctx, filename), "auto", filename)
+	if err != nil {
+		return nil, errors.Errorf("resolving formatter: %w", err)
+	}
+	if fmtr == nil {
+		fmtr = autoformat.SniffFormatter([]byte(text))
+	}
+
+	if fmtr == nil {
+		return []*Diagnostic{}, nil
+	}
+	if reg := format.DefaultRegistry.Find(fmtr); reg == nil || !reg.Has(format.CapabilityDiagnostics) {
+		return []*Diagnostic{}, nil
+	}
+
+	_, err = format.Format(ctx, fmtr, me.configFor(ctx, filename), filename, strings.NewReader(text))
+	if err != nil {
+		return diagnosticsFromError(text, err), nil
+	}
+
+	return []*Diagnostic{}, nil
+}
+
+// diagnosticsFromError turns the parse errors of the native formatters into
+// diagnostics. Any other error is reported at the start of the document.
+func diagnosticsFromError(text string, err error) []*Diagnostic {
+	lines := format.SplitLines([]byte(text))
+
+	diags := []*Diagnostic{}
+	for _, diag := range format.DiagnosticsFromError("", err) {
+		severity := SeverityError
+		if diag.Severity == format.SeverityWarning {
+			severity = SeverityWarning
+		}
+
+		rng := Range{}
+		if diag.Line > 0 {
+			rng.Start = Position{Line: diag.Line - 1, Character: character(lines, diag.Line-1, diag.Column)}
+			rng.End = rng.Start
+			if diag.EndLine > 0 {
+				rng.End = Position{Line: diag.EndLine - 1, Character: character(lines, diag.EndLine-1, diag.EndColumn)}
+			}
+		}
+
+		diags = append(diags, &Diagnostic{
+			Range:    rng,
+			Severity: severity,
+			Source:   "retab",
+			Message:  diag.Message,
+		})
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Range.Start.Line < diags[j].Range.Start.Line
+	})
+
+	return diags
+}
+
+// character converts a one-based column counting characters on the line into
+// the zero-based utf-16 offset the protocol expects.
+func character(lines []string, line, column int) int {
+	if line < 0 || line >= len(lines) {
+		return max(column-1, 0)
+	}
+
+	units, chars := 0, 0
+	for _, r := range strings.TrimRight(lines[line], "\r\n") {
+		if chars >= column-1 {
+			return units
+		}
+		units += format.UTF16Len(string(r))
+		chars++
+	}
+
+	return units + max(column-1-chars, 0)
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+
+	return filepath.FromSlash(u.Path)
+}
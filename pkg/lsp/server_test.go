@@ -0,0 +1,227 @@
+package lsp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/lsp"
+)
+
+type testClient struct {
+	t      *testing.T
+	dir    string
+	writer io.Writer
+	reader *textproto.Reader
+}
+
+func (me *testClient) send(id int, method string, params any) {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+	if id > 0 {
+		msg["id"] = id
+	}
+
+	body, err := json.Marshal(msg)
+	require.NoError(me.t, err, "encoding message should succeed")
+
+	_, err = io.WriteString(me.writer, "Content-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"+string(body))
+	require.NoError(me.t, err, "writing message should succeed")
+}
+
+func (me *testClient) receive(result any) map[string]json.RawMessage {
+	header, err := me.reader.ReadMIMEHeader()
+	require.NoError(me.t, err, "reading header should succeed")
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	require.NoError(me.t, err, "parsing content length should succeed")
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(me.reader.R, body)
+	require.NoError(me.t, err, "reading body should succeed")
+
+	msg := map[string]json.RawMessage{}
+	require.NoError(me.t, json.Unmarshal(body, &msg), "decoding message should succeed")
+
+	field := "result"
+	if _, ok := msg["params"]; ok {
+		field = "params"
+	}
+	if result != nil {
+		require.NoError(me.t, json.Unmarshal(msg[field], result), "decoding %s should succeed", field)
+	}
+
+	return msg
+}
+
+func startServer(t *testing.T) *testClient {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte("root = true\n[*]\nindent_style = tab\nindent_size = 4\n"), 0644)
+	require.NoError(t, err, "writing editorconfig should succeed")
+
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- lsp.NewServer("test").Run(context.Background(), serverReader, serverWriter)
+	}()
+
+	client := &testClient{t: t, writer: clientWriter, reader: textproto.NewReader(bufio.NewReader(clientReader))}
+
+	t.Cleanup(func() {
+		client.send(99, "shutdown", nil)
+		for {
+			if msg := client.receive(nil); string(msg["id"]) == "99" {
+				break
+			}
+		}
+		client.send(0, "exit", nil)
+		assert.NoError(t, <-done, "server should exit cleanly after shutdown")
+	})
+
+	client.send(1, "initialize", map[string]any{"rootUri": "file://" + dir})
+	client.receive(nil)
+
+	client.dir = dir
+	return client
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	serverReader, clientWriter := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- lsp.NewServer("test").Run(context.Background(), serverReader, io.Discard)
+	}()
+
+	client := &testClient{t: t, writer: clientWriter}
+	client.send(0, "exit", nil)
+
+	var exitErr *lsp.ExitWithoutShutdownError
+	assert.ErrorAs(t, <-done, &exitErr, "exit without shutdown should be reported")
+}
+
+func (me *testClient) open(name, text string) string {
+	uri := "file://" + filepath.Join(me.dir, name)
+	me.send(0, "textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "", "version": 1, "text": text},
+	})
+	return uri
+}
+
+func TestFormatting(t *testing.T) {
+	client := startServer(t)
+
+	uri := client.open("main.hcl", "a=1\nbb = 2\n")
+
+	diags := &lsp.PublishDiagnosticsParams{}
+	client.receive(diags)
+	assert.Empty(t, diags.Diagnostics, "valid document should have no diagnostics")
+
+	client.send(2, "textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}})
+
+	edits := []*lsp.TextEdit{}
+	client.receive(&edits)
+	require.Len(t, edits, 1, "formatting should return one edit")
+	assert.Equal(t, lsp.Range{Start: lsp.Position{Line: 0, Character: 1}, End: lsp.Position{Line: 0, Character: 2}}, edits[0].Range, "edit should only cover the changed text")
+	assert.Equal(t, "  = ", edits[0].NewText, "edit should contain the formatted text")
+}
+
+func TestRangeFormatting(t *testing.T) {
+	client := startServer(t)
+
+	uri := client.open("main.hcl", "a = 1\n\nb=2\n\nc=3\n")
+	client.receive(nil)
+
+	client.send(2, "textDocument/rangeFormatting", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"range":        map[string]any{"start": map[string]any{"line": 4, "character": 0}, "end": map[string]any{"line": 4, "character": 3}},
+	})
+
+	edits := []*lsp.TextEdit{}
+	client.receive(&edits)
+	require.Len(t, edits, 1, "range formatting should only return edits inside the range")
+	assert.Equal(t, 4, edits[0].Range.Start.Line, "edit should start on the selected line")
+	assert.Equal(t, "c = 3\n", edits[0].NewText, "edit should contain the formatted line")
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name      string
+		filename  string
+		text      string
+		line      int
+		character int
+	}{
+		{
+			name:      "hcl_missing_expression",
+			filename:  "main.hcl",
+			text:      "a = 1\nb =\n",
+			line:      1,
+			character: 3,
+		},
+		{
+			name:      "hcl_columns_in_utf16",
+			filename:  "main.hcl",
+			text:      "a = \"\U0001F600\" b\n",
+			line:      0,
+			character: 9,
+		},
+		{
+			name:      "proto_missing_semicolon",
+			filename:  "main.proto",
+			text:      "syntax = \"proto3\";\nmessage A {\n\tstring a = 1\n}\n",
+			line:      3,
+			character: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := startServer(t)
+
+			client.open(tt.filename, tt.text)
+
+			diags := &lsp.PublishDiagnosticsParams{}
+			client.receive(diags)
+			require.Len(t, diags.Diagnostics, 1, "invalid document should have one diagnostic")
+			assert.Equal(t, lsp.SeverityError, diags.Diagnostics[0].Severity, "parse errors should be errors")
+			assert.Equal(t, tt.line, diags.Diagnostics[0].Range.Start.Line, "diagnostic should point at the error")
+			assert.Equal(t, tt.character, diags.Diagnostics[0].Range.Start.Character, "diagnostic column should count utf-16 code units")
+		})
+	}
+}
+
+func TestCancelRequest(t *testing.T) {
+	client := startServer(t)
+
+	err := os.WriteFile(filepath.Join(client.dir, ".editorconfig"), []byte("root = true\n[*]\nindent_style = tab\nindent_size = 4\n[*.slow]\nretab_external_command = sleep 10\n"), 0644)
+	require.NoError(t, err, "writing editorconfig should succeed")
+
+	slow := client.open("main.slow", "a\n")
+	client.receive(nil)
+	fast := client.open("main.hcl", "a=1\n")
+	client.receive(nil)
+
+	client.send(2, "textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": slow}})
+	client.send(3, "textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": fast}})
+
+	edits := []*lsp.TextEdit{}
+	msg := client.receive(&edits)
+	assert.JSONEq(t, "3", string(msg["id"]), "the fast request should not wait for the slow one")
+	assert.Len(t, edits, 1, "formatting should return one edit")
+
+	client.send(0, "$/cancelRequest", map[string]any{"id": 2})
+
+	msg = client.receive(nil)
+	assert.JSONEq(t, "2", string(msg["id"]), "the cancelled request should be answered")
+	assert.JSONEq(t, `{"code": -32800, "message": "request cancelled"}`, string(msg["error"]), "the request should fail as cancelled")
+}